@@ -0,0 +1,380 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Built-in actions, selected by name in Options.Action or a config rule.
+const (
+	ActionReport            = "report"
+	ActionTag               = "tag"
+	ActionQuarantine        = "quarantine"
+	ActionArchiveThenDelete = "archive-then-delete"
+	ActionLifecycleExpire   = "lifecycle-expire"
+	ActionBatchManifest     = "batch-manifest"
+	ActionDelete            = "delete"
+)
+
+const (
+	orphanTag          = "cleanup:orphaned"
+	actionDeclinedText = "declined interactively"
+)
+
+var actionNames = []string{
+	ActionReport,
+	ActionTag,
+	ActionQuarantine,
+	ActionArchiveThenDelete,
+	ActionLifecycleExpire,
+	ActionBatchManifest,
+	ActionDelete,
+}
+
+// ActionTarget is a planned bucket handed to an Action.
+type ActionTarget struct {
+	*PlannedBucket
+	S3 s3iface.S3API
+	// DryRun asks the action to report what it would do without doing it.
+	DryRun bool
+	c      *Cleaner
+}
+
+// Log writes a progress message to the run's logger.
+func (t *ActionTarget) Log(v ...interface{}) {
+	t.c.log(v...)
+}
+
+// ActionResult is the outcome an action reports for one bucket.
+type ActionResult struct {
+	Outcome string
+	Reason  string
+	// Errors are objects S3 failed to delete.
+	Errors []*s3.Error
+	// Err aborts the run, as AWS errors do in the built-in actions.
+	Err error
+}
+
+// Action is what a run does to each orphaned bucket in its plan.
+type Action interface {
+	Name() string
+	Apply(ctx context.Context, target *ActionTarget) *ActionResult
+}
+
+// NewAction returns the built-in action named by options.Action, with the
+// settings it needs from options. Archive is required by
+// archive-then-delete, and with delete the objects are archived first as
+// well. BatchJob is required by batch-manifest.
+func NewAction(options Options) (Action, error) {
+	name, archive := options.Action, options.Archive
+	switch name {
+	case ActionReport:
+		return &reportAction{}, nil
+	case ActionTag:
+		return &tagAction{}, nil
+	case ActionQuarantine:
+		return &quarantineAction{}, nil
+	case ActionArchiveThenDelete:
+		if archive == nil {
+			return nil, fmt.Errorf("%s needs an archive", name)
+		}
+		return &deleteAction{archive: archive}, nil
+	case ActionLifecycleExpire:
+		if options.LifecycleBackupBucket == "" {
+			return nil, fmt.Errorf("%s needs a lifecycle backup bucket", name)
+		}
+		return &lifecycleAction{}, nil
+	case ActionBatchManifest:
+		if options.BatchJob == nil {
+			return nil, fmt.Errorf("%s needs a batch job", name)
+		}
+		return &batchAction{job: options.BatchJob}, nil
+	case ActionDelete, "":
+		return &deleteAction{archive: archive}, nil
+	}
+	return nil, fmt.Errorf("unknown action %q", name)
+}
+
+func (c *Cleaner) bucketAction() Action {
+	if c.action == nil {
+		return &deleteAction{}
+	}
+	return c.action
+}
+
+func planSummary(planned *PlannedBucket) string {
+	summary := fmt.Sprintf("%d objects, %d bytes", len(planned.Objects), planned.Size())
+	if len(planned.Dependents) > 0 {
+		summary += "; " + describeDependents(planned.Dependents)
+	}
+	return summary
+}
+
+// reportAction only lists the buckets a run found.
+type reportAction struct{}
+
+func (a *reportAction) Name() string {
+	return ActionReport
+}
+
+func (a *reportAction) Apply(
+	ctx context.Context,
+	target *ActionTarget,
+) *ActionResult {
+	return &ActionResult{Outcome: OutcomeReported, Reason: planSummary(target.PlannedBucket)}
+}
+
+// tagAction marks the bucket with the time it was found orphaned so
+// owners can claim it before a stricter rule removes it.
+type tagAction struct{}
+
+func (a *tagAction) Name() string {
+	return ActionTag
+}
+
+func (a *tagAction) Apply(
+	ctx context.Context,
+	target *ActionTarget,
+) *ActionResult {
+	if target.DryRun {
+		return &ActionResult{Outcome: OutcomeWouldTag, Reason: orphanTag}
+	}
+	tagged, err := target.c.addBucketTag(ctx, target.Bucket, orphanTag, timestamp())
+	if err != nil {
+		return &ActionResult{Err: err}
+	}
+	if !tagged {
+		return &ActionResult{Outcome: OutcomeTagged, Reason: "already tagged"}
+	}
+	target.Log("Tagged bucket: ", *target.Bucket.Name)
+	return &ActionResult{Outcome: OutcomeTagged, Reason: orphanTag}
+}
+
+// quarantineAction blocks object access, see quarantineBucket.
+type quarantineAction struct{}
+
+func (a *quarantineAction) Name() string {
+	return ActionQuarantine
+}
+
+func (a *quarantineAction) Apply(
+	ctx context.Context,
+	target *ActionTarget,
+) *ActionResult {
+	if target.DryRun {
+		return &ActionResult{
+			Outcome: OutcomeWouldQuarantine,
+			Reason:  planSummary(target.PlannedBucket),
+		}
+	}
+	quarantined, err := target.c.quarantineBucket(ctx, target.Bucket)
+	if err != nil {
+		return &ActionResult{Err: err}
+	}
+	if !quarantined {
+		return &ActionResult{Outcome: OutcomeQuarantined, Reason: "already quarantined"}
+	}
+	target.Log("Quarantined bucket: ", *target.Bucket.Name)
+	return &ActionResult{Outcome: OutcomeQuarantined}
+}
+
+// deleteAction empties and deletes the bucket, copying the objects to the
+// archive first when there is one.
+type deleteAction struct {
+	archive *Archive
+}
+
+func (a *deleteAction) Name() string {
+	if a.archive != nil {
+		return ActionArchiveThenDelete
+	}
+	return ActionDelete
+}
+
+func (a *deleteAction) Apply(
+	ctx context.Context,
+	target *ActionTarget,
+) *ActionResult {
+	reason := ""
+	if a.archive != nil {
+		reason = "archived to " + a.archive.Bucket
+	}
+	if target.DryRun {
+		summary := planSummary(target.PlannedBucket)
+		if a.archive != nil {
+			summary += ", " + reason
+		}
+		return &ActionResult{Outcome: OutcomeWouldDelete, Reason: summary}
+	}
+	bucket := target.Bucket
+	target.Log("This bucket is to be deleted: ", *bucket.Name)
+	errs, err := a.empty(ctx, target, target.Objects, target.identifiers())
+	if err != nil {
+		return &ActionResult{Errors: errs, Err: err}
+	}
+	if len(errs) > 0 {
+		return &ActionResult{
+			Outcome: OutcomeFailed,
+			Reason:  describeErrors(errs),
+			Errors:  errs,
+		}
+	}
+	_, err = target.S3.DeleteBucketWithContext(
+		ctx,
+		&s3.DeleteBucketInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if err != nil {
+		return &ActionResult{Err: err}
+	}
+	return &ActionResult{Outcome: OutcomeDeleted, Reason: reason}
+}
+
+func (a *deleteAction) empty(
+	ctx context.Context,
+	target *ActionTarget,
+	objects []*s3.Object,
+	ids []*s3.ObjectIdentifier,
+) ([]*s3.Error, error) {
+	if a.archive != nil && !isBucketEmpty(objects) {
+		err := target.c.archiveObjects(ctx, a.archive, target.Bucket, objects)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return target.c.deleteObjects(ctx, target.Bucket, ids, target.BypassGovernance)
+}
+
+// hasObjectVersions reports whether noncurrent versions or delete markers,
+// which ListObjects does not show, still keep the bucket from being
+// deleted.
+func (c *Cleaner) hasObjectVersions(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (bool, error) {
+	resp, err := c.s3SVC.ListObjectVersionsWithContext(
+		ctx,
+		&s3.ListObjectVersionsInput{
+			Bucket:  bucket.Name,
+			MaxKeys: aws.Int64(1),
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return len(resp.Versions) > 0 || len(resp.DeleteMarkers) > 0, nil
+}
+
+// finishPendingBucket deletes a bucket an earlier run left for S3 to empty
+// once nothing is left in it, and reports it as pending until then.
+func (c *Cleaner) finishPendingBucket(
+	ctx context.Context,
+	target *ActionTarget,
+	pending string,
+) *ActionResult {
+	bucket := target.Bucket
+	empty := isBucketEmpty(target.Objects)
+	if empty {
+		versions, err := c.hasObjectVersions(ctx, bucket)
+		if err != nil {
+			return &ActionResult{Err: err}
+		}
+		empty = !versions
+	}
+	if !empty {
+		left := fmt.Sprintf("%d objects left", len(target.Objects))
+		if target.Pending {
+			left = "objects left"
+		}
+		return &ActionResult{Outcome: OutcomePending, Reason: pending + ", " + left}
+	}
+	if target.DryRun {
+		return &ActionResult{Outcome: OutcomeWouldDelete, Reason: pending}
+	}
+	target.Log("This bucket is to be deleted: ", *bucket.Name)
+	_, err := target.S3.DeleteBucketWithContext(
+		ctx,
+		&s3.DeleteBucketInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if err != nil {
+		return &ActionResult{Err: err}
+	}
+	return &ActionResult{Outcome: OutcomeDeleted, Reason: pending}
+}
+
+// describeErrors summarises the objects DeleteObjects could not delete by
+// error code.
+func describeErrors(errs []*s3.Error) string {
+	counts := map[string]int{}
+	for _, err := range errs {
+		counts[aws.StringValue(err.Code)]++
+	}
+	var codes []string
+	for code, count := range counts {
+		codes = append(codes, fmt.Sprintf("%d %s", count, code))
+	}
+	sort.Strings(codes)
+	return "could not empty bucket: " + strings.Join(codes, ", ")
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// removeBuckets applies the rule's action to each bucket of a removal
+// plan and records the outcome the action reports.
+func (c *Cleaner) removeBuckets(
+	ctx context.Context,
+	plan []*PlannedBucket,
+) ([]*s3.Error, error) {
+	errors := []*s3.Error{}
+	action := c.bucketAction()
+	if removesData(action.Name()) {
+		if err := c.enforceLimits(plan); err != nil {
+			return errors, err
+		}
+	}
+	for i, planned := range plan {
+		if err := ctx.Err(); err != nil {
+			return errors, err
+		}
+		if c.prompter != nil && !c.dryRun && action.Name() != ActionReport {
+			switch c.prompter.confirm(c.describePlannedBucket(planned), action.Name()) {
+			case answerSkip:
+				c.skipBucket(planned.Bucket, actionDeclinedText)
+				continue
+			case answerQuit:
+				for _, remaining := range plan[i:] {
+					c.skipBucket(remaining.Bucket, "run quit interactively")
+				}
+				return errors, nil
+			}
+		}
+		result := action.Apply(
+			ctx,
+			&ActionTarget{
+				PlannedBucket: planned,
+				S3:            c.s3SVC,
+				DryRun:        c.dryRun,
+				c:             c,
+			},
+		)
+		errors = append(errors, result.Errors...)
+		if result.Err != nil {
+			c.recordBucket(planned.Bucket, OutcomeFailed, result.Err.Error())
+			return errors, result.Err
+		}
+		c.recordBucket(planned.Bucket, result.Outcome, result.Reason)
+	}
+	return errors, nil
+}
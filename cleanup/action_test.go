@@ -0,0 +1,180 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+type recordingAction struct {
+	applied []string
+}
+
+func (a *recordingAction) Name() string {
+	return "record"
+}
+
+func (a *recordingAction) Apply(
+	ctx context.Context,
+	target *ActionTarget,
+) *ActionResult {
+	a.applied = append(a.applied, *target.Bucket.Name)
+	return &ActionResult{Outcome: "recorded", Reason: "custom"}
+}
+
+func TestNewAction(t *testing.T) {
+	archive := &Archive{Bucket: "archive"}
+	var tests = []struct {
+		name     string
+		archive  *Archive
+		backup   string
+		expected string
+		ok       bool
+	}{
+		{name: "", expected: ActionDelete, ok: true},
+		{name: ActionTag, expected: ActionTag, ok: true},
+		{name: ActionLifecycleExpire, backup: "backups", expected: ActionLifecycleExpire, ok: true},
+		{name: ActionLifecycleExpire, ok: false},
+		{name: ActionDelete, archive: archive, expected: ActionArchiveThenDelete, ok: true},
+		{name: ActionArchiveThenDelete, archive: archive, expected: ActionArchiveThenDelete, ok: true},
+		{name: ActionArchiveThenDelete, ok: false},
+		{name: ActionBatchManifest, ok: false},
+		{name: "shred", ok: false},
+	}
+	for _, test := range tests {
+		action, err := NewAction(Options{
+			Action:                test.name,
+			Archive:               test.archive,
+			LifecycleBackupBucket: test.backup,
+		})
+		if (err == nil) != test.ok {
+			t.Errorf("Expected ok %v for %q but got %v", test.ok, test.name, err)
+			continue
+		}
+		if err == nil && action.Name() != test.expected {
+			t.Errorf("Expected %v for %q but got %v", test.expected, test.name, action.Name())
+		}
+	}
+}
+
+func TestTagAction(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(&s3.GetBucketTaggingOutput{TagSet: []*s3.Tag{}}, nil)
+	mockS3Iface.EXPECT().PutBucketTaggingWithContext(gomock.Any(), gomock.Any()).Do(
+		func(_ aws.Context, input *s3.PutBucketTaggingInput, _ ...request.Option) {
+			if !hasTag(input.Tagging.TagSet, orphanTag, "") {
+				t.Errorf("Expected the %v tag but got %v", orphanTag, input.Tagging.TagSet)
+			}
+		},
+	).Return(&s3.PutBucketTaggingOutput{}, nil)
+
+	result := (&tagAction{}).Apply(
+		context.Background(),
+		&ActionTarget{
+			PlannedBucket: &PlannedBucket{Bucket: bucket},
+			S3:            mockS3Iface,
+			c:             csbc,
+		},
+	)
+	if result.Outcome != OutcomeTagged || result.Err != nil {
+		t.Errorf("Expected '%v' but got %v", OutcomeTagged, result)
+	}
+}
+
+func TestLifecycleExpireAction(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{
+		s3SVC:                 mockS3Iface,
+		lifecycleBackupBucket: "backups",
+		lifecycleBackupPrefix: DefaultLifecycleBackupPrefix,
+	}
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketTaggingOutput{TagSet: []*s3.Tag{}},
+		nil,
+	).Times(2)
+	mockS3Iface.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New(errCodeNoSuchKey, "none", nil),
+	)
+	mockS3Iface.EXPECT().GetBucketLifecycleConfigurationWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New(errCodeNoSuchLifecycleConfiguration, "none", nil),
+	)
+	mockS3Iface.EXPECT().PutObjectWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.PutObjectOutput{},
+		nil,
+	)
+	mockS3Iface.EXPECT().PutBucketLifecycleConfigurationWithContext(gomock.Any(), gomock.Any()).Do(
+		func(_ aws.Context, input *s3.PutBucketLifecycleConfigurationInput, _ ...request.Option) {
+			rules := input.LifecycleConfiguration.Rules
+			if len(rules) != 1 || aws.StringValue(rules[0].ID) != expireLifecycleID {
+				t.Errorf("Expected the %v rule but got %v", expireLifecycleID, rules)
+			}
+		},
+	).Return(&s3.PutBucketLifecycleConfigurationOutput{}, nil)
+	mockS3Iface.EXPECT().PutBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.PutBucketTaggingOutput{},
+		nil,
+	)
+
+	result := (&lifecycleAction{}).Apply(
+		context.Background(),
+		&ActionTarget{
+			PlannedBucket: &PlannedBucket{Bucket: bucket},
+			S3:            mockS3Iface,
+			c:             csbc,
+		},
+	)
+	if result.Outcome != OutcomeExpiring || result.Err != nil {
+		t.Errorf("Expected '%v' but got %v", OutcomeExpiring, result)
+	}
+}
+
+func TestRemoveBucketsWithCustomAction(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	action := &recordingAction{}
+	csbc := &Cleaner{s3SVC: mockS3Iface, action: action}
+	plan := []*PlannedBucket{
+		&PlannedBucket{Bucket: &s3.Bucket{Name: aws.String("a")}},
+		&PlannedBucket{Bucket: &s3.Bucket{Name: aws.String("b")}},
+	}
+
+	errs, err := csbc.removeBuckets(context.Background(), plan)
+	if err != nil || len(errs) != 0 || len(action.applied) != 2 {
+		t.Errorf("Expected the action applied to 2 buckets but got %v", action.applied)
+	}
+	for _, entry := range csbc.report {
+		if entry.Outcome != "recorded" || entry.Reason != "custom" {
+			t.Errorf("Expected the action's outcome but got %v", entry)
+		}
+	}
+}
+
+func TestDescribeErrors(t *testing.T) {
+	errs := []*s3.Error{
+		&s3.Error{Code: aws.String("AccessDenied"), Key: aws.String("a")},
+		&s3.Error{Code: aws.String("InternalError"), Key: aws.String("b")},
+		&s3.Error{Code: aws.String("AccessDenied"), Key: aws.String("c")},
+	}
+	expected := "could not empty bucket: 1 InternalError, 2 AccessDenied"
+	if result := describeErrors(errs); result != expected {
+		t.Errorf("Expected '%v' but got '%v'", expected, result)
+	}
+}
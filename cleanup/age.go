@@ -0,0 +1,58 @@
+package cleanup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const day = 24 * time.Hour
+
+// DaysToDuration converts a number of days to a duration.
+func DaysToDuration(days int) time.Duration {
+	return time.Duration(days) * day
+}
+
+func formatDays(d time.Duration) string {
+	return fmt.Sprintf("%.1f days", d.Hours()/24)
+}
+
+// lastModified returns the newest LastModified among the objects, or the
+// zero time when there are none.
+func lastModified(objects []*s3.Object) time.Time {
+	var newest time.Time
+	for _, object := range objects {
+		if object.LastModified != nil && object.LastModified.After(newest) {
+			newest = *object.LastModified
+		}
+	}
+	return newest
+}
+
+func (c *Cleaner) bucketAgeReason(bucket *s3.Bucket) string {
+	if c.minBucketAge <= 0 || bucket.CreationDate == nil {
+		return ""
+	}
+	age := time.Since(*bucket.CreationDate)
+	if age >= c.minBucketAge {
+		return ""
+	}
+	return "bucket is " + formatDays(age) + " old, younger than " +
+		formatDays(c.minBucketAge)
+}
+
+// idleReason vetoes deleting a bucket that has been written to recently.
+// It runs on the listing made to empty the bucket so no extra calls are
+// needed.
+func (c *Cleaner) idleReason(objects []*s3.Object) string {
+	if c.minIdleAge <= 0 || isBucketEmpty(objects) {
+		return ""
+	}
+	idle := time.Since(lastModified(objects))
+	if idle >= c.minIdleAge {
+		return ""
+	}
+	return "last object written " + formatDays(idle) + " ago, within " +
+		formatDays(c.minIdleAge)
+}
@@ -0,0 +1,89 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestLastModified(t *testing.T) {
+	newest := getTimeSecondsBeforeNow(10)
+	objects := []*s3.Object{
+		&s3.Object{Key: aws.String("a"), LastModified: getTimeSecondsBeforeNow(500)},
+		&s3.Object{Key: aws.String("b"), LastModified: newest},
+		&s3.Object{Key: aws.String("c")},
+	}
+	if result := lastModified(objects); !result.Equal(*newest) {
+		t.Errorf("Expected %v but got %v", *newest, result)
+	}
+	if result := lastModified([]*s3.Object{}); !result.IsZero() {
+		t.Errorf("Expected zero time but got %v", result)
+	}
+}
+
+func TestBucketAgeReason(t *testing.T) {
+	csbc := &Cleaner{minBucketAge: 2 * day}
+	var tests = []struct {
+		bucket  *s3.Bucket
+		skipped bool
+	}{
+		{
+			bucket:  &s3.Bucket{CreationDate: getTimeSecondsBeforeNow(3600)},
+			skipped: true,
+		},
+		{
+			bucket:  &s3.Bucket{CreationDate: getTimeSecondsBeforeNow(3 * 86400)},
+			skipped: false,
+		},
+	}
+	for _, test := range tests {
+		result := csbc.bucketAgeReason(test.bucket) != ""
+		if result != test.skipped {
+			t.Errorf("Expected skipped '%v' but got '%v'", test.skipped, result)
+		}
+	}
+	disabled := &Cleaner{}
+	if reason := disabled.bucketAgeReason(tests[0].bucket); reason != "" {
+		t.Errorf("Expected no reason when disabled but got '%v'", reason)
+	}
+}
+
+func TestIdleReason(t *testing.T) {
+	csbc := &Cleaner{minIdleAge: 7 * day}
+	var tests = []struct {
+		objects []*s3.Object
+		skipped bool
+	}{
+		{
+			objects: []*s3.Object{
+				&s3.Object{LastModified: getTimeSecondsBeforeNow(30 * 86400)},
+				&s3.Object{LastModified: getTimeSecondsBeforeNow(60)},
+			},
+			skipped: true,
+		},
+		{
+			objects: []*s3.Object{
+				&s3.Object{LastModified: getTimeSecondsBeforeNow(30 * 86400)},
+			},
+			skipped: false,
+		},
+		{
+			objects: []*s3.Object{},
+			skipped: false,
+		},
+	}
+	for _, test := range tests {
+		result := csbc.idleReason(test.objects) != ""
+		if result != test.skipped {
+			t.Errorf("Expected skipped '%v' but got '%v'", test.skipped, result)
+		}
+	}
+}
+
+func TestDaysToDuration(t *testing.T) {
+	if result := DaysToDuration(3); result != 72*time.Hour {
+		t.Errorf("Expected 72h but got %v", result)
+	}
+}
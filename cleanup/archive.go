@@ -0,0 +1,140 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// maxCopyObjectSize is the largest object CopyObject copies in one
+	// request.
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// copyPartSize keeps the largest S3 object, 5 TB, within the 10,000
+	// parts of a multipart upload.
+	copyPartSize = 1024 * 1024 * 1024
+)
+
+func archiveKey(archive *Archive, bucketName string, key string) string {
+	// The key is appended as it is: cleaning it would give "a//b" and
+	// "a/b" the same archive key and let "../x" escape the prefix.
+	prefix := bucketName + "/"
+	if archive.Prefix != "" {
+		prefix = strings.TrimSuffix(archive.Prefix, "/") + "/" + prefix
+	}
+	return prefix + key
+}
+
+// copySource builds the URL-encoded bucket/key form CopyObject expects.
+func copySource(bucketName string, key string) string {
+	return (&url.URL{Path: bucketName + "/" + key}).EscapedPath()
+}
+
+// copyObject copies one object to the archive, in parts when it is too
+// large for a single CopyObject.
+func (c *Cleaner) copyObject(
+	ctx context.Context,
+	archive *Archive,
+	bucket *s3.Bucket,
+	object *s3.Object,
+) error {
+	source := copySource(*bucket.Name, *object.Key)
+	key := archiveKey(archive, *bucket.Name, *object.Key)
+	if aws.Int64Value(object.Size) > maxCopyObjectSize {
+		return c.copyObjectParts(ctx, archive.Bucket, key, source, *object.Size)
+	}
+	_, err := c.s3SVC.CopyObjectWithContext(
+		ctx,
+		&s3.CopyObjectInput{
+			Bucket:     aws.String(archive.Bucket),
+			CopySource: aws.String(source),
+			Key:        aws.String(key),
+		},
+	)
+	return err
+}
+
+// copyObjectParts copies an object of size bytes with UploadPartCopy,
+// aborting the multipart upload if a part fails.
+func (c *Cleaner) copyObjectParts(
+	ctx context.Context,
+	bucketName string,
+	key string,
+	source string,
+	size int64,
+) error {
+	upload, err := c.s3SVC.CreateMultipartUploadWithContext(
+		ctx,
+		&s3.CreateMultipartUploadInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(key),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	var parts []*s3.CompletedPart
+	for start := int64(0); start < size; start += copyPartSize {
+		end := start + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		number := aws.Int64(int64(len(parts) + 1))
+		resp, err := c.s3SVC.UploadPartCopyWithContext(
+			ctx,
+			&s3.UploadPartCopyInput{
+				Bucket:          aws.String(bucketName),
+				Key:             aws.String(key),
+				CopySource:      aws.String(source),
+				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+				PartNumber:      number,
+				UploadId:        upload.UploadId,
+			},
+		)
+		if err != nil {
+			c.s3SVC.AbortMultipartUploadWithContext(
+				ctx,
+				&s3.AbortMultipartUploadInput{
+					Bucket:   aws.String(bucketName),
+					Key:      aws.String(key),
+					UploadId: upload.UploadId,
+				},
+			)
+			return err
+		}
+		parts = append(
+			parts,
+			&s3.CompletedPart{ETag: resp.CopyPartResult.ETag, PartNumber: number},
+		)
+	}
+	_, err = c.s3SVC.CompleteMultipartUploadWithContext(
+		ctx,
+		&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(bucketName),
+			Key:             aws.String(key),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+			UploadId:        upload.UploadId,
+		},
+	)
+	return err
+}
+
+// archiveObjects copies every object to the archive bucket, under
+// <prefix>/<bucket>/<key>, before the bucket is emptied.
+func (c *Cleaner) archiveObjects(
+	ctx context.Context,
+	archive *Archive,
+	bucket *s3.Bucket,
+	objects []*s3.Object,
+) error {
+	for _, object := range objects {
+		if err := c.copyObject(ctx, archive, bucket, object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestArchiveKey(t *testing.T) {
+	var tests = []struct {
+		prefix   string
+		key      string
+		expected string
+	}{
+		{prefix: "cleanup", key: "dir/a.txt", expected: "cleanup/team-a-logs/dir/a.txt"},
+		{prefix: "cleanup/", key: "a//b", expected: "cleanup/team-a-logs/a//b"},
+		{prefix: "cleanup", key: "dir/", expected: "cleanup/team-a-logs/dir/"},
+		{prefix: "cleanup", key: "../x", expected: "cleanup/team-a-logs/../x"},
+		{prefix: "", key: "/a", expected: "team-a-logs//a"},
+	}
+	for _, test := range tests {
+		archive := &Archive{Bucket: "archive", Prefix: test.prefix}
+		if result := archiveKey(archive, "team-a-logs", test.key); result != test.expected {
+			t.Errorf("Expected '%v' but got '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestArchiveObjects(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{
+		s3SVC: mockS3Iface,
+	}
+	mockS3Iface.EXPECT().CopyObjectWithContext(
+		gomock.Any(),
+		&s3.CopyObjectInput{
+			Bucket:     aws.String("archive"),
+			CopySource: aws.String("team-a-logs/dir/a%20b.txt"),
+			Key:        aws.String("cleanup/team-a-logs/dir/a b.txt"),
+		},
+	).Return(&s3.CopyObjectOutput{}, nil)
+
+	err := csbc.archiveObjects(
+		context.Background(),
+		&Archive{Bucket: "archive", Prefix: "cleanup"},
+		bucket,
+		[]*s3.Object{&s3.Object{Key: aws.String("dir/a b.txt")}},
+	)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestArchiveLargeObject(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	size := int64(maxCopyObjectSize + copyPartSize/2)
+	mockS3Iface.EXPECT().CreateMultipartUploadWithContext(
+		gomock.Any(),
+		&s3.CreateMultipartUploadInput{
+			Bucket: aws.String("archive"),
+			Key:    aws.String("cleanup/team-a-logs/big"),
+		},
+	).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")}, nil)
+	var ranges []string
+	mockS3Iface.EXPECT().UploadPartCopyWithContext(gomock.Any(), gomock.Any()).Do(
+		func(_ aws.Context, input *s3.UploadPartCopyInput, _ ...request.Option) {
+			ranges = append(ranges, *input.CopySourceRange)
+		},
+	).Return(
+		&s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String("etag")}},
+		nil,
+	).Times(6)
+	mockS3Iface.EXPECT().CompleteMultipartUploadWithContext(gomock.Any(), gomock.Any()).Do(
+		func(_ aws.Context, input *s3.CompleteMultipartUploadInput, _ ...request.Option) {
+			if len(input.MultipartUpload.Parts) != 6 ||
+				*input.MultipartUpload.Parts[5].PartNumber != 6 {
+				t.Errorf("Expected 6 numbered parts but got %v", input.MultipartUpload.Parts)
+			}
+		},
+	).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+
+	err := csbc.archiveObjects(
+		context.Background(),
+		&Archive{Bucket: "archive", Prefix: "cleanup"},
+		bucket,
+		[]*s3.Object{&s3.Object{Key: aws.String("big"), Size: aws.Int64(size)}},
+	)
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	last := fmt.Sprintf("bytes=%d-%d", 5*copyPartSize, size-1)
+	if len(ranges) != 6 || ranges[0] != fmt.Sprintf("bytes=0-%d", copyPartSize-1) || ranges[5] != last {
+		t.Errorf("Expected the object to be copied in 6 ranges but got %v", ranges)
+	}
+}
+
+func TestArchiveLargeObjectAbortsOnError(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	mockS3Iface.EXPECT().CreateMultipartUploadWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")},
+		nil,
+	)
+	mockS3Iface.EXPECT().UploadPartCopyWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New("AccessDenied", "denied", nil),
+	)
+	mockS3Iface.EXPECT().AbortMultipartUploadWithContext(
+		gomock.Any(),
+		&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String("archive"),
+			Key:      aws.String("cleanup/team-a-logs/big"),
+			UploadId: aws.String("upload"),
+		},
+	).Return(&s3.AbortMultipartUploadOutput{}, nil)
+
+	err := csbc.archiveObjects(
+		context.Background(),
+		&Archive{Bucket: "archive", Prefix: "cleanup"},
+		bucket,
+		[]*s3.Object{&s3.Object{Key: aws.String("big"), Size: aws.Int64(maxCopyObjectSize + 1)}},
+	)
+	if err == nil {
+		t.Errorf("Expected the part error")
+	}
+}
@@ -0,0 +1,208 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	DefaultBatchManifestDir = "batch-manifests"
+
+	batchPendingTag     = "cleanup:batch-delete"
+	batchManifestFormat = "S3BatchOperations_CSV_20180820"
+	batchReportFormat   = "Report_CSV_20180820"
+	batchPriority       = 10
+)
+
+// BatchJob describes the S3 Batch Operations jobs the batch-manifest
+// action writes. Operators upload each manifest to Bucket under Prefix,
+// where the job reports are written too, and submit the job definition.
+// Batch Operations has no delete operation, so each task invokes the
+// Lambda function FunctionArn.
+type BatchJob struct {
+	// Dir is the local directory the files are written to. It defaults
+	// to DefaultBatchManifestDir.
+	Dir         string `yaml:"dir"`
+	Bucket      string `yaml:"bucket"`
+	Prefix      string `yaml:"prefix"`
+	AccountID   string `yaml:"accountId"`
+	RoleArn     string `yaml:"roleArn"`
+	FunctionArn string `yaml:"functionArn"`
+}
+
+func (job *BatchJob) validate() []string {
+	var problems []string
+	if job.Bucket == "" {
+		problems = append(problems, "batchJob needs a bucket")
+	}
+	if job.AccountID == "" || job.RoleArn == "" || job.FunctionArn == "" {
+		problems = append(problems, "batchJob needs accountId, roleArn and functionArn")
+	}
+	return problems
+}
+
+func (job *BatchJob) dir() string {
+	if job.Dir == "" {
+		return DefaultBatchManifestDir
+	}
+	return job.Dir
+}
+
+// batchJobDefinition is the input of s3control CreateJob.
+type batchJobDefinition struct {
+	AccountID            string `json:"AccountId"`
+	ConfirmationRequired bool
+	Description          string
+	Priority             int
+	RoleArn              string
+	Operation            struct {
+		LambdaInvoke struct {
+			FunctionArn string
+		}
+	}
+	Manifest struct {
+		Spec struct {
+			Format string
+			Fields []string
+		}
+		Location struct {
+			ObjectArn string
+			ETag      string
+		}
+	}
+	Report struct {
+		Bucket      string
+		Prefix      string
+		Format      string
+		Enabled     bool
+		ReportScope string
+	}
+}
+
+// escapeBatchKey URL-encodes a key as Batch Operations manifests expect.
+func escapeBatchKey(key string) string {
+	return strings.Replace(url.QueryEscape(key), "+", "%20", -1)
+}
+
+// batchManifest returns the CSV manifest of everything to delete in the
+// bucket, with the fields of each line.
+func batchManifest(planned *PlannedBucket) ([]byte, []string) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	fields := []string{"Bucket", "Key"}
+	if len(planned.Versions) > 0 {
+		fields = append(fields, "VersionId")
+	}
+	for _, id := range planned.identifiers() {
+		line := []string{*planned.Bucket.Name, escapeBatchKey(*id.Key)}
+		if len(planned.Versions) > 0 {
+			line = append(line, aws.StringValue(id.VersionId))
+		}
+		writer.Write(line)
+	}
+	writer.Flush()
+	return buffer.Bytes(), fields
+}
+
+// batchAction hands the deletion of the objects to S3 Batch Operations.
+// It writes a manifest and job definition per bucket and tags the bucket
+// as pending; a later run deletes the bucket once it is observed empty.
+type batchAction struct {
+	job *BatchJob
+}
+
+func (a *batchAction) Name() string {
+	return ActionBatchManifest
+}
+
+func (a *batchAction) Apply(
+	ctx context.Context,
+	target *ActionTarget,
+) *ActionResult {
+	c := target.c
+	bucket := target.Bucket
+	tags, err := c.getBucketTags(ctx, bucket)
+	if err != nil {
+		return &ActionResult{Err: err}
+	}
+	if since := tagValue(tags, batchPendingTag); since != "" {
+		return c.finishPendingBucket(ctx, target, "batch job pending since "+since)
+	}
+	if isBucketEmpty(target.Objects) && len(target.Versions) == 0 {
+		return (&deleteAction{}).Apply(ctx, target)
+	}
+	manifestPath := filepath.Join(a.job.dir(), *bucket.Name+".csv")
+	if target.DryRun {
+		return &ActionResult{
+			Outcome: OutcomeWouldManifest,
+			Reason:  planSummary(target.PlannedBucket) + " to " + manifestPath,
+		}
+	}
+	manifest, fields := batchManifest(target.PlannedBucket)
+	if err := os.MkdirAll(a.job.dir(), 0755); err != nil {
+		return &ActionResult{Err: err}
+	}
+	if err := ioutil.WriteFile(manifestPath, manifest, 0644); err != nil {
+		return &ActionResult{Err: err}
+	}
+	definition, err := json.MarshalIndent(a.definition(bucket, manifest, fields), "", "  ")
+	if err != nil {
+		return &ActionResult{Err: err}
+	}
+	jobPath := filepath.Join(a.job.dir(), *bucket.Name+".job.json")
+	if err := ioutil.WriteFile(jobPath, definition, 0644); err != nil {
+		return &ActionResult{Err: err}
+	}
+	if _, err := c.addBucketTag(ctx, bucket, batchPendingTag, timestamp()); err != nil {
+		return &ActionResult{Err: err}
+	}
+	target.Log("Wrote batch manifest for bucket: ", *bucket.Name)
+	return &ActionResult{
+		Outcome: OutcomeManifest,
+		Reason:  planSummary(target.PlannedBucket) + " to " + manifestPath,
+	}
+}
+
+func (a *batchAction) definition(
+	bucket *s3.Bucket,
+	manifest []byte,
+	fields []string,
+) *batchJobDefinition {
+	sum := md5.Sum(manifest)
+	definition := &batchJobDefinition{
+		AccountID:            a.job.AccountID,
+		ConfirmationRequired: true,
+		Description:          "cleanup of bucket " + *bucket.Name,
+		Priority:             batchPriority,
+		RoleArn:              a.job.RoleArn,
+	}
+	definition.Operation.LambdaInvoke.FunctionArn = a.job.FunctionArn
+	definition.Manifest.Spec.Format = batchManifestFormat
+	definition.Manifest.Spec.Fields = fields
+	definition.Manifest.Location.ObjectArn = fmt.Sprintf(
+		"arn:aws:s3:::%s/%s",
+		a.job.Bucket,
+		path.Join(a.job.Prefix, *bucket.Name+".csv"),
+	)
+	definition.Manifest.Location.ETag = hex.EncodeToString(sum[:])
+	definition.Report.Bucket = "arn:aws:s3:::" + a.job.Bucket
+	definition.Report.Prefix = path.Join(a.job.Prefix, "reports")
+	definition.Report.Format = batchReportFormat
+	definition.Report.Enabled = true
+	definition.Report.ReportScope = "FailedTasksOnly"
+	return definition
+}
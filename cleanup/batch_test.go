@@ -0,0 +1,114 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestBatchManifest(t *testing.T) {
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	var tests = []struct {
+		planned  *PlannedBucket
+		manifest string
+		fields   int
+	}{
+		{
+			planned: &PlannedBucket{
+				Bucket:  bucket,
+				Objects: []*s3.Object{&s3.Object{Key: aws.String("dir/a b,c.txt")}},
+			},
+			manifest: "team-a-logs,dir%2Fa%20b%2Cc.txt\n",
+			fields:   2,
+		},
+		{
+			planned: &PlannedBucket{
+				Bucket: bucket,
+				Versions: []*s3.ObjectIdentifier{
+					&s3.ObjectIdentifier{Key: aws.String("a"), VersionId: aws.String("v1")},
+				},
+			},
+			manifest: "team-a-logs,a,v1\n",
+			fields:   3,
+		},
+	}
+	for _, test := range tests {
+		manifest, fields := batchManifest(test.planned)
+		if string(manifest) != test.manifest || len(fields) != test.fields {
+			t.Errorf(
+				"Expected %q with %v fields but got %q with %v",
+				test.manifest,
+				test.fields,
+				manifest,
+				fields,
+			)
+		}
+	}
+}
+
+func TestBatchActionWritesJob(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	dir := getTempDir(t)
+	defer os.RemoveAll(dir)
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	action := &batchAction{
+		job: &BatchJob{
+			Dir:         dir,
+			Bucket:      "ops",
+			Prefix:      "manifests",
+			AccountID:   "123456789012",
+			RoleArn:     "arn:aws:iam::123456789012:role/batch",
+			FunctionArn: "arn:aws:lambda:us-east-1:123456789012:function:delete",
+		},
+	}
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketTaggingOutput{TagSet: []*s3.Tag{}},
+		nil,
+	).Times(2)
+	mockS3Iface.EXPECT().PutBucketTaggingWithContext(gomock.Any(), gomock.Any()).Do(
+		func(_ aws.Context, input *s3.PutBucketTaggingInput, _ ...request.Option) {
+			if !hasTag(input.Tagging.TagSet, batchPendingTag, "") {
+				t.Errorf("Expected the %v tag but got %v", batchPendingTag, input.Tagging.TagSet)
+			}
+		},
+	).Return(&s3.PutBucketTaggingOutput{}, nil)
+
+	result := action.Apply(
+		context.Background(),
+		&ActionTarget{
+			PlannedBucket: &PlannedBucket{
+				Bucket:  bucket,
+				Objects: []*s3.Object{&s3.Object{Key: aws.String("a")}},
+			},
+			S3: mockS3Iface,
+			c:  csbc,
+		},
+	)
+	if result.Outcome != OutcomeManifest {
+		t.Errorf("Expected '%v' but got %v", OutcomeManifest, result)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "team-a-logs.job.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	definition := &batchJobDefinition{}
+	if err := json.Unmarshal(data, definition); err != nil {
+		t.Fatal(err)
+	}
+	if definition.Manifest.Location.ObjectArn != "arn:aws:s3:::ops/manifests/team-a-logs.csv" ||
+		definition.Manifest.Location.ETag == "" ||
+		definition.AccountID != "123456789012" {
+		t.Errorf("Unexpected job definition %s", data)
+	}
+}
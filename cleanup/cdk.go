@@ -0,0 +1,45 @@
+package cleanup
+
+import (
+	"path"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// CDK names every file and image asset after the SHA-256 of its content
+// and templates refer to assets by that hash.
+var assetHashPattern = regexp.MustCompile(`[a-f0-9]{64}`)
+
+func assetHash(key string) string {
+	return assetHashPattern.FindString(path.Base(key))
+}
+
+func (c *Cleaner) referencedAssetHashes() map[string]bool {
+	hashes := map[string]bool{}
+	for _, reference := range c.stackReferences {
+		if reference.source != "template" {
+			continue
+		}
+		for _, hash := range assetHashPattern.FindAllString(reference.text, -1) {
+			hashes[hash] = true
+		}
+	}
+	return hashes
+}
+
+// cdkStaleAssets returns the old assets whose hash no live stack template
+// mentions. Objects without an asset hash are left alone.
+func cdkStaleAssets(c *Cleaner, objects []*s3.Object) []*s3.Object {
+	var (
+		stale      []*s3.Object
+		referenced = c.referencedAssetHashes()
+	)
+	for _, object := range objects {
+		hash := assetHash(*object.Key)
+		if hash != "" && !referenced[hash] && c.isPruneCandidate(object) {
+			stale = append(stale, object)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,71 @@
+package cleanup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestAssetHash(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	var tests = []struct {
+		key      string
+		expected string
+	}{
+		{key: hash + ".zip", expected: hash},
+		{key: "assets/" + hash + ".json", expected: hash},
+		{key: "readme.txt", expected: ""},
+	}
+	for _, test := range tests {
+		if result := assetHash(test.key); result != test.expected {
+			t.Errorf("Expected '%v' but got '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestCdkStaleAssets(t *testing.T) {
+	var (
+		live   = strings.Repeat("1a", 32)
+		unused = strings.Repeat("2b", 32)
+		recent = strings.Repeat("3c", 32)
+	)
+	csbc := &Cleaner{
+		pruneMinAge: 30 * day,
+		stackReferences: []*stackReference{
+			&stackReference{
+				stackName: "app",
+				source:    "template",
+				text:      `{"S3Key":"` + live + `.zip"}`,
+			},
+			&stackReference{
+				stackName: "app",
+				source:    "parameter AssetHash",
+				text:      unused,
+			},
+		},
+	}
+	objects := []*s3.Object{
+		&s3.Object{
+			Key:          aws.String(live + ".zip"),
+			LastModified: getTimeSecondsBeforeNow(90 * 86400),
+		},
+		&s3.Object{
+			Key:          aws.String(unused + ".zip"),
+			LastModified: getTimeSecondsBeforeNow(90 * 86400),
+		},
+		&s3.Object{
+			Key:          aws.String(recent + ".json"),
+			LastModified: getTimeSecondsBeforeNow(86400),
+		},
+		&s3.Object{
+			Key:          aws.String("notes.txt"),
+			LastModified: getTimeSecondsBeforeNow(90 * 86400),
+		},
+	}
+	stale := cdkStaleAssets(csbc, objects)
+	if len(stale) != 1 || *stale[0].Key != unused+".zip" {
+		t.Errorf("Expected only the unused asset to be stale but got %v", stale)
+	}
+}
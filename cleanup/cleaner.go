@@ -0,0 +1,621 @@
+package cleanup
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/allanliu/easylogger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const maxDeleteObjects = 1000
+
+// Logger receives progress messages.
+type Logger interface {
+	Log(v ...interface{})
+}
+
+// Options configure a Cleaner. The zero value of a field keeps the
+// default behaviour.
+type Options struct {
+	S3             s3iface.S3API
+	CloudFormation cloudformationiface.CloudFormationAPI
+	// S3ForRegion returns a client for buckets located in region. The
+	// replication, logging and notification configuration of every bucket
+	// is read through it; S3 is used when it is nil.
+	S3ForRegion func(region string) s3iface.S3API
+	// Logger defaults to easylogger.
+	Logger Logger
+	// Prompter, when set, asks for approval before each bucket is deleted.
+	Prompter *Prompter
+
+	// RuleName labels the report entries of the run.
+	RuleName string
+	// BucketFilter is a substring candidate bucket names contain. It is
+	// ignored when BucketPatterns, a list of glob patterns, is set.
+	BucketFilter   string
+	BucketPatterns []string
+	// BucketRegion restricts the run to buckets located in that region.
+	BucketRegion string
+	// Region is the region of the run. Shared buckets are only pruned in
+	// it; every region is pruned when it is empty.
+	Region string
+
+	// Buckets with this tag, or a policy statement with this Sid, are
+	// never deleted.
+	ProtectTagKey    string
+	ProtectTagValue  string
+	ProtectPolicySid string
+	// IgnoreRetain deletes buckets retained by deleted stacks.
+	IgnoreRetain bool
+	// SkipReferenceCheck does not look for buckets referenced by live
+	// stack templates, parameters, outputs or exports.
+	SkipReferenceCheck  bool
+	DeleteSharedBuckets bool
+	// PruneShared plans the pruning of stale objects in shared buckets
+	// older than PruneMinAge instead of deleting buckets.
+	PruneShared  bool
+	PruneMinAge  time.Duration
+	MinBucketAge time.Duration
+	MinIdleAge   time.Duration
+
+	// Apply refuses plans above these limits unless Force is set. Zero
+	// means no limit.
+	MaxBuckets int
+	MaxObjects int64
+	MaxBytes   int64
+	Force      bool
+	// DryRun makes Apply report the plan without changing anything.
+	DryRun bool
+
+	// Ownership is an ownership strategy spec for ParseOwnershipStrategy,
+	// used unless OwnershipStrategy is set. It defaults to the score.
+	Ownership               string
+	OwnershipStrategy       OwnershipStrategy
+	OwnershipThreshold      int
+	CreationWindow          time.Duration
+	CreationWindowAfterOnly bool
+	MatchResourceTime       bool
+
+	// CallerUserID is the aws:userid of the credentials the run uses, as
+	// returned by STS GetCallerIdentity. The quarantine action needs it to
+	// exempt the tool from the deny it adds.
+	CallerUserID string
+	// Action names a built-in action and defaults to ActionDelete.
+	// CustomAction, when set, is used instead.
+	Action       string
+	CustomAction Action
+	Archive      *Archive
+	BatchJob     *BatchJob
+	// LifecycleBackupBucket is the bucket the lifecycle-expire action saves
+	// the lifecycle configuration it replaces to, under
+	// LifecycleBackupPrefix. The prefix defaults to
+	// DefaultLifecycleBackupPrefix.
+	LifecycleBackupBucket string
+	LifecycleBackupPrefix string
+	// BypassGovernanceRetention deletes objects under Object Lock
+	// governance retention. Buckets with such objects are otherwise
+	// reported as undeletable, as are buckets with compliance retention
+	// or legal holds.
+	BypassGovernanceRetention bool
+	// UseInventory lists buckets from their latest CSV S3 Inventory
+	// report instead of ListObjects where one is configured.
+	UseInventory bool
+	// AllowDependents plans the removal of buckets other resources depend
+	// on: replication sources and destinations and event notification
+	// sources. They are otherwise skipped. Access log targets of other
+	// buckets are always skipped.
+	AllowDependents bool
+	// Policy is an expression a bucket must satisfy to be removed.
+	Policy string
+}
+
+// Cleaner finds and removes the S3 buckets CloudFormation stacks left
+// behind.
+type Cleaner struct {
+	cfSVC                 cloudformationiface.CloudFormationAPI
+	s3SVC                 s3iface.S3API
+	stacks                []*cloudformation.StackSummary
+	deletedStacks         []*cloudformation.StackSummary
+	bucketFilter          string
+	protectTagKey         string
+	protectTagValue       string
+	protectPolicySid      string
+	retainedBuckets       map[string]string
+	stackReferences       []*stackReference
+	minBucketAge          time.Duration
+	minIdleAge            time.Duration
+	limits                runLimits
+	deleteSharedBuckets   bool
+	pruneMinAge           time.Duration
+	stackActivity         []time.Time
+	dryRun                bool
+	stackBuckets          map[string]*cloudformation.StackSummary
+	ownershipThreshold    int
+	creationWindow        *creationWindow
+	matchResourceTime     bool
+	bucketResources       map[string]map[string]string
+	ruleName              string
+	bucketPatterns        []string
+	bucketRegion          string
+	region                string
+	strategy              OwnershipStrategy
+	inventory             *StackInventory
+	action                Action
+	callerUserID          string
+	lifecycleBackupBucket string
+	lifecycleBackupPrefix string
+	useInventory          bool
+	bypassGovernance      bool
+	allowDependents       bool
+	links                 *bucketLinks
+	s3ForRegion           func(region string) s3iface.S3API
+	regionClients         map[string]s3iface.S3API
+	policy                *expression
+	prompter              *Prompter
+	ignoreRetain          bool
+	skipReferenceCheck    bool
+	pruneShared           bool
+	logger                Logger
+	report                []*ReportEntry
+}
+
+// New returns a Cleaner for the given options.
+func New(options Options) (*Cleaner, error) {
+	action := options.CustomAction
+	if action == nil {
+		var err error
+		action, err = NewAction(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	strategy := options.OwnershipStrategy
+	if strategy == nil && options.Ownership != "" {
+		var err error
+		strategy, err = ParseOwnershipStrategy(options.Ownership)
+		if err != nil {
+			return nil, err
+		}
+	}
+	policy, err := parsePolicy(options.Policy)
+	if err != nil {
+		return nil, err
+	}
+	if options.CreationWindow == 0 {
+		options.CreationWindow = DefaultCreationWindow
+	}
+	if options.LifecycleBackupPrefix == "" {
+		options.LifecycleBackupPrefix = DefaultLifecycleBackupPrefix
+	}
+	return &Cleaner{
+		cfSVC:               options.CloudFormation,
+		s3SVC:               options.S3,
+		bucketFilter:        options.BucketFilter,
+		protectTagKey:       options.ProtectTagKey,
+		protectTagValue:     options.ProtectTagValue,
+		protectPolicySid:    options.ProtectPolicySid,
+		minBucketAge:        options.MinBucketAge,
+		minIdleAge:          options.MinIdleAge,
+		deleteSharedBuckets: options.DeleteSharedBuckets,
+		pruneMinAge:         options.PruneMinAge,
+		dryRun:              options.DryRun,
+		ownershipThreshold:  options.OwnershipThreshold,
+		creationWindow: newCreationWindow(
+			options.CreationWindow,
+			options.CreationWindowAfterOnly,
+		),
+		matchResourceTime:     options.MatchResourceTime,
+		ruleName:              options.RuleName,
+		bucketPatterns:        options.BucketPatterns,
+		bucketRegion:          options.BucketRegion,
+		region:                options.Region,
+		callerUserID:          options.CallerUserID,
+		strategy:              strategy,
+		action:                action,
+		lifecycleBackupBucket: options.LifecycleBackupBucket,
+		lifecycleBackupPrefix: options.LifecycleBackupPrefix,
+		useInventory:          options.UseInventory,
+		bypassGovernance:      options.BypassGovernanceRetention,
+		allowDependents:       options.AllowDependents,
+		s3ForRegion:           options.S3ForRegion,
+		policy:                policy,
+		prompter:              options.Prompter,
+		ignoreRetain:          options.IgnoreRetain,
+		skipReferenceCheck:    options.SkipReferenceCheck,
+		pruneShared:           options.PruneShared,
+		logger:                options.Logger,
+		limits: runLimits{
+			maxBuckets: options.MaxBuckets,
+			maxObjects: options.MaxObjects,
+			maxBytes:   options.MaxBytes,
+			force:      options.Force,
+		},
+	}, nil
+}
+
+func (c *Cleaner) log(v ...interface{}) {
+	if c.logger == nil {
+		easylogger.Log(v...)
+		return
+	}
+	c.logger.Log(v...)
+}
+
+// loadStacks gathers what the live stacks say about buckets.
+func (c *Cleaner) loadStacks(ctx context.Context) error {
+	c.inventory = nil
+	c.deletedStacks = nil
+	if err := c.getAllCfStackNames(ctx); err != nil {
+		return err
+	}
+	if err := c.getStackBuckets(ctx); err != nil {
+		return err
+	}
+	if !c.ignoreRetain {
+		if err := c.getRetainedBuckets(ctx); err != nil {
+			return err
+		}
+	}
+	if !c.skipReferenceCheck || c.pruneShared {
+		if err := c.getStackReferences(ctx); err != nil {
+			return err
+		}
+	}
+	if c.pruneShared {
+		return c.getStackActivity(ctx)
+	}
+	return nil
+}
+
+// getAllCfStackNames loads the live stacks: every stack that is not
+// DELETE_COMPLETE plus any nested stack whose root stack is live.
+func (c *Cleaner) getAllCfStackNames(ctx context.Context) error {
+	var (
+		stacks []*cloudformation.StackSummary
+		token  *string
+	)
+	for {
+		resp, err := c.cfSVC.ListStacksWithContext(
+			ctx,
+			&cloudformation.ListStacksInput{
+				NextToken:         token,
+				StackStatusFilter: aws.StringSlice(discoveredStackStatuses),
+			},
+		)
+		if err != nil {
+			return err
+		}
+		stacks = append(stacks, resp.StackSummaries...)
+		if resp.NextToken == nil {
+			break
+		}
+		token = resp.NextToken
+	}
+	c.stacks = liveStacks(stacks)
+	return nil
+}
+
+// checkStackBucketbyName ignores case because CloudFormation lowercases
+// stack names such as Parent-Child-XYZ123 or StackSet-name-uuid when it
+// generates bucket names from them.
+func checkStackBucketbyName(bucketName string, stackName string) bool {
+	return strings.Contains(
+		strings.ToLower(bucketName),
+		strings.ToLower(stackName),
+	)
+}
+
+func isCloudformationBucket(bucketName string, bucketFilter string) bool {
+	return strings.Contains(bucketName, bucketFilter)
+}
+
+func checkStackBucketbyDate(bucketDate time.Time, stackDate time.Time) bool {
+	return defaultCreationWindow.matches(bucketDate, stackDate)
+}
+
+func (c *Cleaner) isBucketDeletable(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (bool, error) {
+	decision, err := c.decideOwnership(ctx, bucket)
+	if err != nil {
+		return false, err
+	}
+	return decision.Verdict != VerdictOwned, nil
+}
+
+// skipReason runs the safeguards that can veto the deletion of a bucket
+// isBucketDeletable considers orphaned. It returns the first reason found,
+// or an empty string when the bucket may be deleted.
+func (c *Cleaner) skipReason(ctx context.Context, bucket *s3.Bucket) (string, error) {
+	if reason, err := c.protectionReason(ctx, bucket); err != nil || reason != "" {
+		return reason, err
+	}
+	checks := []func(*s3.Bucket) string{
+		c.retainReason,
+		c.referenceReason,
+		c.sharedBucketReason,
+		c.bucketAgeReason,
+		c.backupBucketReason,
+	}
+	for _, check := range checks {
+		if reason := check(bucket); reason != "" {
+			return reason, nil
+		}
+	}
+	return "", nil
+}
+
+// getBucketContents returns every object in the bucket, from its latest
+// inventory when Options.UseInventory is set.
+func (c *Cleaner) getBucketContents(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) ([]*s3.Object, error) {
+	listing, err := c.getBucketListing(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return listing.Objects, nil
+}
+
+// getBucketListing plans the removal of everything in the bucket,
+// including the object versions an inventory lists.
+func (c *Cleaner) getBucketListing(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (*PlannedBucket, error) {
+	if c.useInventory {
+		planned, err := c.getInventoryListing(ctx, bucket)
+		if err != nil || planned != nil {
+			return planned, err
+		}
+	}
+	objects, err := c.listObjects(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &PlannedBucket{Bucket: bucket, Objects: objects}, nil
+}
+
+// listObjects lists every object in the bucket, following ListObjects
+// pagination until the listing is no longer truncated.
+func (c *Cleaner) listObjects(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) ([]*s3.Object, error) {
+	var (
+		objects []*s3.Object
+		marker  *string
+	)
+	for {
+		resp, err := c.s3SVC.ListObjectsWithContext(
+			ctx,
+			&s3.ListObjectsInput{
+				Bucket: bucket.Name,
+				Marker: marker,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, resp.Contents...)
+		if !aws.BoolValue(resp.IsTruncated) || len(resp.Contents) == 0 {
+			return objects, nil
+		}
+		marker = resp.NextMarker
+		if marker == nil {
+			marker = resp.Contents[len(resp.Contents)-1].Key
+		}
+	}
+}
+
+func getObjectIDStruct(objects []*s3.Object) []*s3.ObjectIdentifier {
+	var result []*s3.ObjectIdentifier
+	for _, object := range objects {
+		result = append(
+			result,
+			&s3.ObjectIdentifier{
+				Key: object.Key,
+			},
+		)
+	}
+	return result
+}
+
+func isBucketEmpty(objects []*s3.Object) bool {
+	return len(objects) <= 0
+}
+
+func (c *Cleaner) emptyBucket(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	objects []*s3.Object,
+) ([]*s3.Error, error) {
+	return c.deleteObjects(ctx, bucket, getObjectIDStruct(objects), false)
+}
+
+// deleteObjects deletes the objects in batches of maxDeleteObjects, the
+// most a single DeleteObjects request accepts.
+func (c *Cleaner) deleteObjects(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	ids []*s3.ObjectIdentifier,
+	bypassGovernance bool,
+) ([]*s3.Error, error) {
+	errors := []*s3.Error{}
+	for start := 0; start < len(ids); start += maxDeleteObjects {
+		end := start + maxDeleteObjects
+		if end > len(ids) {
+			end = len(ids)
+		}
+		input := &s3.DeleteObjectsInput{
+			Bucket: bucket.Name,
+			Delete: &s3.Delete{
+				Objects: ids[start:end],
+			},
+		}
+		if bypassGovernance {
+			input.BypassGovernanceRetention = aws.Bool(true)
+		}
+		resp, err := c.s3SVC.DeleteObjectsWithContext(ctx, input)
+		if err != nil {
+			return errors, err
+		}
+		errors = append(errors, resp.Errors...)
+	}
+	return errors, nil
+}
+
+func (c *Cleaner) listBuckets(ctx context.Context) ([]*s3.Bucket, error) {
+	resp, err := c.s3SVC.ListBucketsWithContext(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Buckets, nil
+}
+
+func (c *Cleaner) skipBucket(bucket *s3.Bucket, reason string) {
+	c.log("Skipping bucket ", *bucket.Name, ": ", reason)
+	c.recordBucket(bucket, OutcomeSkipped, reason)
+}
+
+// bucketVerdict is what a run concludes about one bucket. An empty
+// outcome puts the listing in the plan; otherwise the bucket is recorded
+// with outcome and reason.
+type bucketVerdict struct {
+	candidate bool
+	decision  *OwnershipDecision
+	listing   *PlannedBucket
+	outcome   string
+	reason    string
+}
+
+func (v *bucketVerdict) keep(outcome string, reason string) *bucketVerdict {
+	v.outcome = outcome
+	v.reason = reason
+	return v
+}
+
+// decideBucket runs every check on one bucket, in order, without
+// recording anything. planBucketRemoval and explain both use it so a
+// verdict is never explained differently from how it is planned.
+func (c *Cleaner) decideBucket(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	buckets []*s3.Bucket,
+) (*bucketVerdict, error) {
+	v := &bucketVerdict{}
+	candidate, err := c.isCandidateBucket(ctx, bucket)
+	if err != nil || !candidate {
+		return v, err
+	}
+	v.candidate = true
+	v.decision, err = c.decideOwnership(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if v.decision.Verdict == VerdictOwned {
+		return v.keep(OutcomeKept, c.describeDecision(v.decision)), nil
+	}
+	reason, err := c.skipReason(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return v.keep(OutcomeSkipped, reason), nil
+	}
+	reason, err = c.linkReason(ctx, bucket, buckets)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return v.keep(OutcomeSkipped, reason), nil
+	}
+	dependents, err := c.bucketDependents(ctx, bucket, buckets)
+	if err != nil {
+		return nil, err
+	}
+	if len(dependents) > 0 && !c.allowDependents {
+		return v.keep(OutcomeSkipped, describeDependents(dependents)), nil
+	}
+	v.listing, err = c.getPendingListing(ctx, bucket)
+	if err != nil || v.listing != nil {
+		return v, err
+	}
+	v.listing, err = c.getBucketListing(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	v.listing.Dependents = dependents
+	objects := v.listing.Objects
+	v.decision, err = c.decideListedOwnership(ctx, bucket, objects)
+	if err != nil {
+		return nil, err
+	}
+	if v.decision.Verdict == VerdictOwned {
+		return v.keep(OutcomeKept, c.describeDecision(v.decision)), nil
+	}
+	if v.decision.Verdict == VerdictUnknown {
+		return v.keep(OutcomeSkipped, c.describeDecision(v.decision)), nil
+	}
+	if reason := c.idleReason(objects); reason != "" {
+		return v.keep(OutcomeSkipped, reason), nil
+	}
+	if reason := inventoryReason(v.listing); reason != "" {
+		return v.keep(OutcomeSkipped, reason), nil
+	}
+	reason, err = c.policyReason(ctx, bucket, v.decision, objects)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return v.keep(OutcomeSkipped, reason), nil
+	}
+	reason, err = c.objectLockReason(ctx, v.listing)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return v.keep(OutcomeUndeletable, reason), nil
+	}
+	return v, nil
+}
+
+// planBucketRemoval decides which buckets are to be deleted without
+// mutating anything, so the whole plan can be checked against the run
+// limits first.
+func (c *Cleaner) planBucketRemoval(ctx context.Context) ([]*PlannedBucket, error) {
+	var plan []*PlannedBucket
+	buckets, err := c.listBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.links = nil
+	for _, bucket := range buckets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		verdict, err := c.decideBucket(ctx, bucket, buckets)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !verdict.candidate:
+		case verdict.outcome == "":
+			plan = append(plan, verdict.listing)
+		case verdict.outcome == OutcomeKept:
+			c.recordBucket(bucket, OutcomeKept, verdict.reason)
+		default:
+			c.log("Skipping bucket ", *bucket.Name, ": ", verdict.reason)
+			c.recordBucket(bucket, verdict.outcome, verdict.reason)
+		}
+	}
+	return plan, nil
+}
@@ -1,12 +1,14 @@
-package main
+package cleanup
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/PermissionData/cloudformation_s3bucket_cleanup/mock_cloudformationiface"
 	"github.com/PermissionData/cloudformation_s3bucket_cleanup/mock_s3iface"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/golang/mock/gomock"
@@ -33,9 +35,65 @@ func getMocks(t *testing.T) (
 	return mockCloudformationiface, mockS3Iface, ctrl
 }
 
+// expectBucketConfiguration answers the tag, replication, logging,
+// notification and object lock lookups of a plan with empty
+// configurations. Call it after the test's own expectations, which take
+// precedence.
+func expectBucketConfiguration(mockS3Iface *mock_s3iface.MockS3API) {
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New(errCodeNoSuchTagSet, "no tags", nil),
+	).AnyTimes()
+	mockS3Iface.EXPECT().GetBucketReplicationWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New(errCodeReplicationConfigurationNotFound, "none", nil),
+	).AnyTimes()
+	mockS3Iface.EXPECT().GetBucketLoggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketLoggingOutput{},
+		nil,
+	).AnyTimes()
+	mockS3Iface.EXPECT().GetBucketNotificationConfigurationWithContext(
+		gomock.Any(),
+		gomock.Any(),
+	).Return(&s3.NotificationConfiguration{}, nil).AnyTimes()
+	mockS3Iface.EXPECT().GetObjectLockConfigurationWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New(errCodeObjectLockConfigurationNotFound, "none", nil),
+	).AnyTimes()
+}
+
+// runRemoval plans and removes buckets the way Plan and Apply do.
+func runRemoval(t *testing.T, c *Cleaner) []*s3.Error {
+	ctx := context.Background()
+	plan, err := c.planBucketRemoval(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	errs, err := c.removeBuckets(ctx, plan)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return errs
+}
+
+// runPrune plans and prunes shared buckets the way Plan and Apply do.
+func runPrune(t *testing.T, c *Cleaner) []*s3.Error {
+	ctx := context.Background()
+	plan, err := c.planSharedPrune(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	errs, err := c.pruneBuckets(ctx, plan)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return errs
+}
+
 func TestRemoveUnusedCFBuckets(t *testing.T) {
 	mockCloudformationiface, mockS3Iface, ctrl := getMocks(t)
 	defer ctrl.Finish()
+	expectBucketConfiguration(mockS3Iface)
 
 	validatePositiveResults := func(errs []*s3.Error) {
 		numErrors := len(errs)
@@ -47,14 +105,14 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 
 	var (
 		happyPathTests = struct {
-			tests    []*cfS3BucketCleanup
+			tests    []*Cleaner
 			bucket1  *s3.Bucket
 			objects1 []*s3.Object
 			bucket2  *s3.Bucket
 			objects2 []*s3.Object
 		}{
-			tests: []*cfS3BucketCleanup{
-				&cfS3BucketCleanup{
+			tests: []*Cleaner{
+				&Cleaner{
 					s3SVC: mockS3Iface,
 					cfSVC: mockCloudformationiface,
 					stacks: []*cloudformation.StackSummary{
@@ -69,7 +127,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 					},
 					bucketFilter: "s3BucketTest",
 				},
-				&cfS3BucketCleanup{
+				&Cleaner{
 					s3SVC: mockS3Iface,
 					cfSVC: mockCloudformationiface,
 					stacks: []*cloudformation.StackSummary{
@@ -84,7 +142,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 					},
 					bucketFilter: "s3BucketTest",
 				},
-				&cfS3BucketCleanup{
+				&Cleaner{
 					s3SVC: mockS3Iface,
 					cfSVC: mockCloudformationiface,
 					stacks: []*cloudformation.StackSummary{
@@ -118,7 +176,8 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 		}
 	)
 	for _, test := range happyPathTests.tests {
-		mockS3Iface.EXPECT().ListObjects(
+		mockS3Iface.EXPECT().ListObjectsWithContext(
+			gomock.Any(),
 			&s3.ListObjectsInput{
 				Bucket: happyPathTests.bucket2.Name,
 			},
@@ -126,7 +185,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			&s3.ListObjectsOutput{Contents: happyPathTests.objects2},
 			nil,
 		)
-		mockS3Iface.EXPECT().ListBuckets(&s3.ListBucketsInput{}).Return(
+		mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
 			&s3.ListBucketsOutput{
 				Buckets: []*s3.Bucket{
 					happyPathTests.bucket1,
@@ -139,7 +198,8 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			},
 			nil,
 		)
-		mockS3Iface.EXPECT().DeleteObjects(
+		mockS3Iface.EXPECT().DeleteObjectsWithContext(
+			gomock.Any(),
 			&s3.DeleteObjectsInput{
 				Bucket: happyPathTests.bucket2.Name,
 				Delete: &s3.Delete{
@@ -154,22 +214,23 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			&s3.DeleteObjectsOutput{Errors: []*s3.Error{}},
 			nil,
 		)
-		mockS3Iface.EXPECT().DeleteBucket(
+		mockS3Iface.EXPECT().DeleteBucketWithContext(
+			gomock.Any(),
 			&s3.DeleteBucketInput{Bucket: happyPathTests.bucket2.Name},
 		).Return(&s3.DeleteBucketOutput{}, nil)
 
-		validatePositiveResults(test.removeUnusedCFBuckets())
+		validatePositiveResults(runRemoval(t, test))
 	}
 	var emptyBucketErrorsTests = struct {
-		tests    []*cfS3BucketCleanup
+		tests    []*Cleaner
 		bucket1  *s3.Bucket
 		objects1 []*s3.Object
 		bucket2  *s3.Bucket
 		objects2 []*s3.Object
 	}{
-		tests: []*cfS3BucketCleanup{
+		tests: []*Cleaner{
 
-			&cfS3BucketCleanup{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -182,7 +243,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				},
 				bucketFilter: "s3BucketTest",
 			},
-			&cfS3BucketCleanup{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -195,7 +256,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				},
 				bucketFilter: "s3BucketTest",
 			},
-			&cfS3BucketCleanup{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -231,7 +292,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 		},
 	}
 	for _, test := range emptyBucketErrorsTests.tests {
-		mockS3Iface.EXPECT().ListBuckets(&s3.ListBucketsInput{}).Return(
+		mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
 			&s3.ListBucketsOutput{
 				Buckets: []*s3.Bucket{
 					emptyBucketErrorsTests.bucket1,
@@ -245,7 +306,8 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			nil,
 		)
 		gomock.InOrder(
-			mockS3Iface.EXPECT().ListObjects(
+			mockS3Iface.EXPECT().ListObjectsWithContext(
+				gomock.Any(),
 				&s3.ListObjectsInput{
 					Bucket: emptyBucketErrorsTests.bucket1.Name,
 				},
@@ -255,7 +317,8 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				},
 				nil,
 			),
-			mockS3Iface.EXPECT().ListObjects(
+			mockS3Iface.EXPECT().ListObjectsWithContext(
+				gomock.Any(),
 				&s3.ListObjectsInput{
 					Bucket: emptyBucketErrorsTests.bucket2.Name,
 				},
@@ -267,7 +330,8 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			),
 		)
 		gomock.InOrder(
-			mockS3Iface.EXPECT().DeleteObjects(
+			mockS3Iface.EXPECT().DeleteObjectsWithContext(
+				gomock.Any(),
 				&s3.DeleteObjectsInput{
 					Bucket: emptyBucketErrorsTests.bucket1.Name,
 					Delete: &s3.Delete{
@@ -290,7 +354,8 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				},
 				nil,
 			),
-			mockS3Iface.EXPECT().DeleteObjects(
+			mockS3Iface.EXPECT().DeleteObjectsWithContext(
+				gomock.Any(),
 				&s3.DeleteObjectsInput{
 					Bucket: emptyBucketErrorsTests.bucket2.Name,
 					Delete: &s3.Delete{
@@ -315,7 +380,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			),
 		)
 
-		errs := test.removeUnusedCFBuckets()
+		errs := runRemoval(t, test)
 
 		nErrors := len(errs)
 		if nErrors != 2 {
@@ -323,13 +388,13 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 		}
 	}
 	var noCFBucketsTests = struct {
-		tests   []*cfS3BucketCleanup
+		tests   []*Cleaner
 		bucket1 *s3.Bucket
 		bucket2 *s3.Bucket
 	}{
-		tests: []*cfS3BucketCleanup{
+		tests: []*Cleaner{
 
-			&cfS3BucketCleanup{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -342,7 +407,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				},
 				bucketFilter: "B3SucketTest",
 			},
-			&cfS3BucketCleanup{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -355,7 +420,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				},
 				bucketFilter: "bucketS3Test",
 			},
-			&cfS3BucketCleanup{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -379,7 +444,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 		},
 	}
 	for _, test := range noCFBucketsTests.tests {
-		mockS3Iface.EXPECT().ListBuckets(&s3.ListBucketsInput{}).Return(
+		mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
 			&s3.ListBucketsOutput{
 				Buckets: []*s3.Bucket{
 					noCFBucketsTests.bucket1,
@@ -392,15 +457,15 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			},
 			nil,
 		)
-		validatePositiveResults(test.removeUnusedCFBuckets())
+		validatePositiveResults(runRemoval(t, test))
 	}
 	var bucketsEmptyTests = struct {
-		tests   []*cfS3BucketCleanup
+		tests   []*Cleaner
 		bucket1 *s3.Bucket
 		bucket2 *s3.Bucket
 	}{
-		tests: []*cfS3BucketCleanup{
-			&cfS3BucketCleanup{
+		tests: []*Cleaner{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -413,7 +478,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				},
 				bucketFilter: "s3BucketTest",
 			},
-			&cfS3BucketCleanup{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -426,7 +491,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				},
 				bucketFilter: "s3BucketTest",
 			},
-			&cfS3BucketCleanup{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -450,7 +515,7 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 		},
 	}
 	for _, test := range bucketsEmptyTests.tests {
-		mockS3Iface.EXPECT().ListBuckets(&s3.ListBucketsInput{}).Return(
+		mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
 			&s3.ListBucketsOutput{
 				Buckets: []*s3.Bucket{
 					bucketsEmptyTests.bucket1,
@@ -464,7 +529,8 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			nil,
 		)
 		gomock.InOrder(
-			mockS3Iface.EXPECT().ListObjects(
+			mockS3Iface.EXPECT().ListObjectsWithContext(
+				gomock.Any(),
 				&s3.ListObjectsInput{
 					Bucket: bucketsEmptyTests.bucket1.Name,
 				},
@@ -472,7 +538,8 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 				&s3.ListObjectsOutput{Contents: []*s3.Object{}},
 				nil,
 			),
-			mockS3Iface.EXPECT().ListObjects(
+			mockS3Iface.EXPECT().ListObjectsWithContext(
+				gomock.Any(),
 				&s3.ListObjectsInput{
 					Bucket: bucketsEmptyTests.bucket2.Name,
 				},
@@ -482,18 +549,20 @@ func TestRemoveUnusedCFBuckets(t *testing.T) {
 			),
 		)
 		gomock.InOrder(
-			mockS3Iface.EXPECT().DeleteBucket(
+			mockS3Iface.EXPECT().DeleteBucketWithContext(
+				gomock.Any(),
 				&s3.DeleteBucketInput{
 					Bucket: bucketsEmptyTests.bucket1.Name,
 				},
 			).Return(&s3.DeleteBucketOutput{}, nil),
-			mockS3Iface.EXPECT().DeleteBucket(
+			mockS3Iface.EXPECT().DeleteBucketWithContext(
+				gomock.Any(),
 				&s3.DeleteBucketInput{
 					Bucket: bucketsEmptyTests.bucket2.Name,
 				},
 			).Return(&s3.DeleteBucketOutput{}, nil),
 		)
-		validatePositiveResults(test.removeUnusedCFBuckets())
+		validatePositiveResults(runRemoval(t, test))
 	}
 }
 
@@ -502,12 +571,12 @@ func TestEmptyBucket(t *testing.T) {
 	defer ctrl.Finish()
 
 	var happyPathTests = struct {
-		tests    []*cfS3BucketCleanup
+		tests    []*Cleaner
 		bucket1  *s3.Bucket
 		objects1 []*s3.Object
 	}{
-		tests: []*cfS3BucketCleanup{
-			&cfS3BucketCleanup{
+		tests: []*Cleaner{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -535,7 +604,8 @@ func TestEmptyBucket(t *testing.T) {
 		},
 	}
 	for _, test := range happyPathTests.tests {
-		mockS3Iface.EXPECT().DeleteObjects(
+		mockS3Iface.EXPECT().DeleteObjectsWithContext(
+			gomock.Any(),
 			gomock.Any(),
 		).Return(
 			&s3.DeleteObjectsOutput{
@@ -543,22 +613,23 @@ func TestEmptyBucket(t *testing.T) {
 			},
 			nil,
 		)
-		errs := test.emptyBucket(
+		errs, err := test.emptyBucket(
+			context.Background(),
 			happyPathTests.bucket1,
 			happyPathTests.objects1,
 		)
 		noErrors := len(errs)
-		if noErrors > 0 {
+		if err != nil || noErrors > 0 {
 			t.Errorf("Expected 0 errors but got %v", noErrors)
 		}
 	}
 	var negativeTests = struct {
-		tests    []*cfS3BucketCleanup
+		tests    []*Cleaner
 		bucket1  *s3.Bucket
 		objects1 []*s3.Object
 	}{
-		tests: []*cfS3BucketCleanup{
-			&cfS3BucketCleanup{
+		tests: []*Cleaner{
+			&Cleaner{
 				s3SVC: mockS3Iface,
 				cfSVC: mockCloudformationiface,
 				stacks: []*cloudformation.StackSummary{
@@ -586,7 +657,8 @@ func TestEmptyBucket(t *testing.T) {
 		},
 	}
 	for _, test := range negativeTests.tests {
-		mockS3Iface.EXPECT().DeleteObjects(
+		mockS3Iface.EXPECT().DeleteObjectsWithContext(
+			gomock.Any(),
 			gomock.Any(),
 		).Return(
 			&s3.DeleteObjectsOutput{
@@ -600,12 +672,13 @@ func TestEmptyBucket(t *testing.T) {
 			},
 			nil,
 		)
-		errs := test.emptyBucket(
+		errs, err := test.emptyBucket(
+			context.Background(),
 			happyPathTests.bucket1,
 			happyPathTests.objects1,
 		)
 		nErrors := len(errs)
-		if nErrors != 1 {
+		if err != nil || nErrors != 1 {
 			t.Errorf("Expected length 1 for errors, got %v", nErrors)
 		}
 	}
@@ -739,30 +812,34 @@ func TestGetBucketContents(t *testing.T) {
 	}
 
 	for _, test := range happyPathTests {
-		csbc := &cfS3BucketCleanup{
+		csbc := &Cleaner{
 			s3SVC: mockS3Iface,
 		}
-		mockS3Iface.EXPECT().ListObjects(
+		mockS3Iface.EXPECT().ListObjectsWithContext(
+			gomock.Any(),
 			&s3.ListObjectsInput{
 				Bucket: test.inputBucket.Name,
 			},
 		).Times(1).Return(test.listObjectsOutput, nil)
-		result := csbc.getBucketContents(test.inputBucket)
+		result, err := csbc.getBucketContents(context.Background(), test.inputBucket)
 		expectedLength := len(test.listObjectsOutput.Contents)
 		resultLength := len(result)
-		if expectedLength != resultLength {
+		if err != nil || expectedLength != resultLength {
 			t.Errorf("Expected length of %v but got %v", expectedLength, resultLength)
 		}
 	}
 }
 
 func TestIsBucketDeletable(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
 	var happyPathTests = []struct {
-		csbc   *cfS3BucketCleanup
+		csbc   *Cleaner
 		bucket *s3.Bucket
 	}{
 		{
-			csbc: &cfS3BucketCleanup{
+			csbc: &Cleaner{
 				stacks: []*cloudformation.StackSummary{
 					&cloudformation.StackSummary{
 						StackName:    aws.String("teststack1"),
@@ -780,7 +857,7 @@ func TestIsBucketDeletable(t *testing.T) {
 			},
 		},
 		{
-			csbc: &cfS3BucketCleanup{
+			csbc: &Cleaner{
 				stacks: []*cloudformation.StackSummary{
 					&cloudformation.StackSummary{
 						StackName:    aws.String("teststack1"),
@@ -798,7 +875,7 @@ func TestIsBucketDeletable(t *testing.T) {
 			},
 		},
 		{
-			csbc: &cfS3BucketCleanup{
+			csbc: &Cleaner{
 				stacks: []*cloudformation.StackSummary{
 					&cloudformation.StackSummary{
 						StackName:    aws.String("teststack1"),
@@ -816,7 +893,7 @@ func TestIsBucketDeletable(t *testing.T) {
 			},
 		},
 		{
-			csbc: &cfS3BucketCleanup{
+			csbc: &Cleaner{
 				stacks: []*cloudformation.StackSummary{
 					&cloudformation.StackSummary{
 						StackName:    aws.String("teststack1"),
@@ -835,17 +912,22 @@ func TestIsBucketDeletable(t *testing.T) {
 		},
 	}
 	for _, test := range happyPathTests {
-		result := test.csbc.isBucketDeletable(test.bucket)
-		if result != true {
+		test.csbc.s3SVC = mockS3Iface
+		mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+			gomock.Any(),
+			&s3.GetBucketTaggingInput{Bucket: test.bucket.Name},
+		).Return(&s3.GetBucketTaggingOutput{}, nil)
+		result, err := test.csbc.isBucketDeletable(context.Background(), test.bucket)
+		if err != nil || result != true {
 			t.Errorf("Expected output of 'true' but got '%v' ", result)
 		}
 	}
 	var negativeTests = []struct {
-		csbc   *cfS3BucketCleanup
+		csbc   *Cleaner
 		bucket *s3.Bucket
 	}{
 		{
-			csbc: &cfS3BucketCleanup{
+			csbc: &Cleaner{
 				stacks: []*cloudformation.StackSummary{
 					&cloudformation.StackSummary{
 						StackName:    aws.String("teststack1"),
@@ -863,7 +945,7 @@ func TestIsBucketDeletable(t *testing.T) {
 			},
 		},
 		{
-			csbc: &cfS3BucketCleanup{
+			csbc: &Cleaner{
 				stacks: []*cloudformation.StackSummary{
 					&cloudformation.StackSummary{
 						StackName:    aws.String("teststack1"),
@@ -881,7 +963,7 @@ func TestIsBucketDeletable(t *testing.T) {
 			},
 		},
 		{
-			csbc: &cfS3BucketCleanup{
+			csbc: &Cleaner{
 				stacks: []*cloudformation.StackSummary{
 					&cloudformation.StackSummary{
 						StackName:    aws.String("teststack1"),
@@ -900,8 +982,13 @@ func TestIsBucketDeletable(t *testing.T) {
 		},
 	}
 	for _, test := range negativeTests {
-		result := test.csbc.isBucketDeletable(test.bucket)
-		if result != false {
+		test.csbc.s3SVC = mockS3Iface
+		mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+			gomock.Any(),
+			&s3.GetBucketTaggingInput{Bucket: test.bucket.Name},
+		).Return(&s3.GetBucketTaggingOutput{}, nil)
+		result, err := test.csbc.isBucketDeletable(context.Background(), test.bucket)
+		if err != nil || result != false {
 			t.Errorf("Expected output of 'false' but got '%v' ", result)
 		}
 	}
@@ -970,3 +1057,120 @@ func TestCheckStackBucketByDate(t *testing.T) {
 		)
 	}
 }
+
+func TestGetBucketContentsPaginated(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("testbucket1")}
+	gomock.InOrder(
+		mockS3Iface.EXPECT().ListObjectsWithContext(
+			gomock.Any(),
+			&s3.ListObjectsInput{Bucket: bucket.Name},
+		).Return(
+			&s3.ListObjectsOutput{
+				IsTruncated: aws.Bool(true),
+				Contents: []*s3.Object{
+					&s3.Object{Key: aws.String("testkey1")},
+					&s3.Object{Key: aws.String("testkey2")},
+				},
+			},
+			nil,
+		),
+		mockS3Iface.EXPECT().ListObjectsWithContext(
+			gomock.Any(),
+			&s3.ListObjectsInput{
+				Bucket: bucket.Name,
+				Marker: aws.String("testkey2"),
+			},
+		).Return(
+			&s3.ListObjectsOutput{
+				IsTruncated: aws.Bool(false),
+				Contents: []*s3.Object{
+					&s3.Object{Key: aws.String("testkey3")},
+				},
+			},
+			nil,
+		),
+	)
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	result, err := csbc.getBucketContents(context.Background(), bucket)
+	if err != nil || len(result) != 3 {
+		t.Errorf("Expected length of %v but got %v", 3, len(result))
+	}
+}
+
+func TestEmptyBucketBatches(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	objects := make([]*s3.Object, maxDeleteObjects+1)
+	for i := range objects {
+		objects[i] = &s3.Object{Key: aws.String("testkey")}
+	}
+	mockS3Iface.EXPECT().DeleteObjectsWithContext(
+		gomock.Any(),
+		gomock.Any(),
+	).Times(2).Return(&s3.DeleteObjectsOutput{}, nil)
+
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	errs, err := csbc.emptyBucket(
+		context.Background(),
+		&s3.Bucket{Name: aws.String("testbucket1")},
+		objects,
+	)
+	if err != nil || len(errs) > 0 {
+		t.Errorf("Expected 0 errors but got %v", len(errs))
+	}
+}
+
+func TestCheckStackBucketByName(t *testing.T) {
+	var tests = []struct {
+		bucketName string
+		stackName  string
+		expected   bool
+	}{
+		{bucketName: "teststack1-bucket-1a2b", stackName: "teststack1", expected: true},
+		{bucketName: "parent-child-xyz123-bucket", stackName: "Parent-Child-XYZ123", expected: true},
+		{bucketName: "teststack2-bucket-1a2b", stackName: "teststack1", expected: false},
+	}
+	for _, test := range tests {
+		result := checkStackBucketbyName(test.bucketName, test.stackName)
+		if result != test.expected {
+			t.Errorf("Expected output of '%v' but got '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestRemoveUnusedCFBucketsDryRun(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	expectBucketConfiguration(mockS3Iface)
+
+	bucket := &s3.Bucket{
+		CreationDate: getTimeSecondsBeforeNow(300),
+		Name:         aws.String("testS3Removal2s3BucketTest"),
+	}
+	csbc := &Cleaner{
+		s3SVC:        mockS3Iface,
+		bucketFilter: "s3BucketTest",
+		limits:       runLimits{maxBuckets: 1},
+		dryRun:       true,
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket, bucket}},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: bucket.Name},
+	).Times(2).Return(&s3.ListObjectsOutput{}, nil)
+
+	errs := runRemoval(t, csbc)
+	if len(errs) > 0 {
+		t.Errorf("Expected 0 errors but got %v", len(errs))
+	}
+	if len(csbc.report) != 2 || csbc.report[0].Outcome != OutcomeWouldDelete {
+		t.Errorf("Expected two dry run entries but got %v", csbc.report)
+	}
+}
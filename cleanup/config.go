@@ -0,0 +1,200 @@
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-[0-9]$`)
+
+// Archive is where objects are copied, under Prefix/<bucket>/<key>,
+// before a bucket is deleted.
+type Archive struct {
+	Bucket string `yaml:"bucket"`
+	Prefix string `yaml:"prefix"`
+}
+
+// Rule is one named policy from a config file. Fields left out keep the
+// value of the Options the rule is applied to.
+type Rule struct {
+	Name               string    `yaml:"name"`
+	Buckets            []string  `yaml:"buckets"`
+	Ownership          string    `yaml:"ownership"`
+	OwnershipThreshold int       `yaml:"ownershipThreshold"`
+	MinBucketAgeDays   int       `yaml:"minBucketAgeDays"`
+	MinIdleDays        int       `yaml:"minIdleDays"`
+	Action             string    `yaml:"action"`
+	Archive            *Archive  `yaml:"archive"`
+	BatchJob           *BatchJob `yaml:"batchJob"`
+	Regions            []string  `yaml:"regions"`
+	Policy             string    `yaml:"policy"`
+}
+
+// Config is a set of rules run one after another.
+type Config struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadConfig reads a YAML or JSON rule file. JSON is valid YAML, so one
+// parser handles both; unknown keys are rejected to catch typos.
+func LoadConfig(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig parses and validates a YAML or JSON rule file.
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (config *Config) validate() error {
+	if len(config.Rules) == 0 {
+		return errors.New("invalid config: no rules defined")
+	}
+	var (
+		problems []string
+		names    = map[string]bool{}
+	)
+	for i, rule := range config.Rules {
+		label := fmt.Sprintf("rule %d", i+1)
+		if rule.Name != "" {
+			label += " (" + rule.Name + ")"
+		}
+		for _, problem := range rule.validate() {
+			problems = append(problems, label+": "+problem)
+		}
+		if rule.Name != "" && names[rule.Name] {
+			problems = append(problems, label+": duplicate rule name")
+		}
+		names[rule.Name] = true
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func (rule *Rule) validate() []string {
+	var problems []string
+	if rule.Name == "" {
+		problems = append(problems, "name is required")
+	}
+	if len(rule.Buckets) == 0 {
+		problems = append(problems, "buckets needs at least one pattern")
+	}
+	for _, pattern := range rule.Buckets {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			problems = append(problems, fmt.Sprintf("bad bucket pattern %q", pattern))
+		}
+	}
+	if rule.Ownership != "" {
+		if _, err := ParseOwnershipStrategy(rule.Ownership); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if rule.OwnershipThreshold < 0 ||
+		rule.MinBucketAgeDays < 0 ||
+		rule.MinIdleDays < 0 {
+		problems = append(problems, "thresholds cannot be negative")
+	}
+	if !contains(actionNames, rule.Action) {
+		problems = append(
+			problems,
+			fmt.Sprintf(
+				"action %q must be one of %s",
+				rule.Action,
+				strings.Join(actionNames, ", "),
+			),
+		)
+	}
+	if rule.Archive != nil {
+		if rule.Action != ActionDelete && rule.Action != ActionArchiveThenDelete {
+			problems = append(
+				problems,
+				"archive only applies to the delete and archive-then-delete actions",
+			)
+		}
+		if rule.Archive.Bucket == "" {
+			problems = append(problems, "archive needs a bucket")
+		}
+	} else if rule.Action == ActionArchiveThenDelete {
+		problems = append(problems, "archive-then-delete needs an archive")
+	}
+	if rule.BatchJob != nil {
+		problems = append(problems, rule.BatchJob.validate()...)
+	} else if rule.Action == ActionBatchManifest {
+		problems = append(problems, "batch-manifest needs a batchJob")
+	}
+	if _, err := parsePolicy(rule.Policy); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, region := range rule.Regions {
+		if !regionPattern.MatchString(region) {
+			problems = append(problems, fmt.Sprintf("bad region %q", region))
+		}
+	}
+	return problems
+}
+
+// RunRegions lists where the rule runs, defaulting to defaultRegion.
+func (rule *Rule) RunRegions(defaultRegion string) []string {
+	if len(rule.Regions) == 0 {
+		return []string{defaultRegion}
+	}
+	return rule.Regions
+}
+
+// Apply overrides options with the settings of the rule for a run in
+// region.
+func (rule *Rule) Apply(options *Options, region string) {
+	options.RuleName = rule.Name
+	options.BucketPatterns = rule.Buckets
+	options.Action = rule.Action
+	options.Archive = rule.Archive
+	if rule.BatchJob != nil {
+		options.BatchJob = rule.BatchJob
+	}
+	if len(rule.Regions) > 0 {
+		options.BucketRegion = region
+	}
+	if rule.Ownership != "" {
+		options.Ownership = rule.Ownership
+	}
+	if rule.Policy != "" {
+		options.Policy = rule.Policy
+	}
+	if rule.OwnershipThreshold > 0 {
+		options.OwnershipThreshold = rule.OwnershipThreshold
+	}
+	if rule.MinBucketAgeDays > 0 {
+		options.MinBucketAge = DaysToDuration(rule.MinBucketAgeDays)
+	}
+	if rule.MinIdleDays > 0 {
+		options.MinIdleAge = DaysToDuration(rule.MinIdleDays)
+	}
+}
@@ -0,0 +1,157 @@
+package cleanup
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	var tests = []struct {
+		name   string
+		config string
+		rules  int
+	}{
+		{
+			name: "yaml",
+			config: `
+rules:
+  - name: team-a
+    buckets: ["team-a-*"]
+    ownership: name-and-date
+    minBucketAgeDays: 7
+    action: delete
+    archive:
+      bucket: archive
+      prefix: team-a
+    regions: [us-east-1, eu-west-1]
+  - name: everyone
+    buckets: ["*exhibitors3bucket*"]
+    action: report
+`,
+			rules: 2,
+		},
+		{
+			name:   "json",
+			config: `{"rules": [{"name": "a", "buckets": ["a-*"], "action": "quarantine"}]}`,
+			rules:  1,
+		},
+	}
+	for _, test := range tests {
+		config, err := ParseConfig([]byte(test.config))
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if len(config.Rules) != test.rules {
+			t.Errorf(
+				"%s: expected %v rules but got %v",
+				test.name,
+				test.rules,
+				len(config.Rules),
+			)
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	var tests = []struct {
+		config   string
+		expected []string
+	}{
+		{config: `rules: []`, expected: []string{"no rules defined"}},
+		{config: `rules: [{name: a, buckets: [a], action: delete, typo: 1}]`, expected: []string{"typo"}},
+		{
+			config: `rules: [{buckets: [a], action: remove}]`,
+			expected: []string{
+				"rule 1: name is required",
+				`action "remove" must be one of report, tag, quarantine, archive-then-delete, lifecycle-expire, batch-manifest, delete`,
+			},
+		},
+		{
+			config: `rules: [{name: a, buckets: ["[a"], action: report, ownership: tags}]`,
+			expected: []string{
+				`rule 1 (a): bad bucket pattern "[a"`,
+				`invalid ownership strategy "tags": unknown strategy "tags"`,
+			},
+		},
+		{
+			config: `rules: [{name: a, buckets: [a], action: report, archive: {prefix: x}}]`,
+			expected: []string{
+				"archive only applies to the delete and archive-then-delete actions",
+				"archive needs a bucket",
+			},
+		},
+		{
+			config:   `rules: [{name: a, buckets: [a], action: archive-then-delete}]`,
+			expected: []string{"archive-then-delete needs an archive"},
+		},
+		{
+			config:   `rules: [{name: a, buckets: [a], action: batch-manifest, batchJob: {bucket: ops}}]`,
+			expected: []string{"batchJob needs accountId, roleArn and functionArn"},
+		},
+		{
+			config:   `rules: [{name: a, buckets: [a], action: report, policy: "owner == 1"}]`,
+			expected: []string{`rule 1 (a): invalid policy "owner == 1": unknown attribute "owner"`},
+		},
+		{
+			config:   `rules: [{name: a, buckets: [a], action: delete, minIdleDays: -1, regions: [mars]}]`,
+			expected: []string{"thresholds cannot be negative", `bad region "mars"`},
+		},
+		{
+			config:   `rules: [{name: a, buckets: [a], action: delete}, {name: a, buckets: [b], action: delete}]`,
+			expected: []string{"rule 2 (a): duplicate rule name"},
+		},
+	}
+	for _, test := range tests {
+		_, err := ParseConfig([]byte(test.config))
+		if err == nil {
+			t.Errorf("Expected an error for %v", test.config)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected '%v' in error '%v'", expected, err)
+			}
+		}
+	}
+}
+
+func TestRuleApply(t *testing.T) {
+	rule := &Rule{
+		Name:             "team-a",
+		Buckets:          []string{"team-a-*"},
+		Ownership:        OwnershipStrategyNameAndDate,
+		MinBucketAgeDays: 2,
+		Action:           ActionQuarantine,
+		Regions:          []string{"eu-west-1"},
+	}
+	options := Options{
+		OwnershipThreshold: 70,
+		MinIdleAge:         time.Hour,
+		Action:             ActionDelete,
+	}
+	rule.Apply(&options, "eu-west-1")
+	if options.RuleName != "team-a" ||
+		options.BucketRegion != "eu-west-1" ||
+		options.Ownership != OwnershipStrategyNameAndDate ||
+		options.Action != ActionQuarantine {
+		t.Errorf("Rule was not applied: %+v", options)
+	}
+	if options.MinBucketAge != 48*time.Hour || options.MinIdleAge != time.Hour {
+		t.Errorf(
+			"Expected ages 48h and 1h but got %v and %v",
+			options.MinBucketAge,
+			options.MinIdleAge,
+		)
+	}
+	if options.OwnershipThreshold != 70 {
+		t.Errorf("Expected the flag threshold to be kept but got %v", options.OwnershipThreshold)
+	}
+	if regions := rule.RunRegions("us-east-1"); len(regions) != 1 || regions[0] != "eu-west-1" {
+		t.Errorf("Expected the rule's regions but got %v", regions)
+	}
+	if regions := (&Rule{}).RunRegions("us-east-1"); regions[0] != "us-east-1" {
+		t.Errorf("Expected the default region but got %v", regions)
+	}
+}
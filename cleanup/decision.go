@@ -0,0 +1,144 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// policyAttributes are the bucket attributes a --policy expression can use.
+var policyAttributes = map[string]bool{
+	"name":          true,
+	"region":        true,
+	"tags":          true,
+	"created":       true,
+	"age_days":      true,
+	"objects":       true,
+	"size":          true,
+	"last_modified": true,
+	"idle_days":     true,
+	"stack_name":    true,
+	"stack_status":  true,
+}
+
+func parsePolicy(source string) (*expression, error) {
+	return parseExpression(source, policyAttributes)
+}
+
+func daysSince(t time.Time) float64 {
+	return time.Since(t).Hours() / 24
+}
+
+// bucketEnv exposes a bucket to a policy expression. Times are RFC 3339
+// strings in UTC, so they compare correctly as strings. A bucket without
+// objects has been idle since it was created. The stack is the live stack
+// matched by name, or else the nearest deleted one. AWS errors looking up
+// the region, tags or deleted stacks are stored in lookupErr.
+func (c *Cleaner) bucketEnv(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	decision *OwnershipDecision,
+	objects []*s3.Object,
+	lookupErr *error,
+) exprEnv {
+	created := aws.TimeValue(bucket.CreationDate)
+	newest := lastModified(objects)
+	stack := decision.Stack
+	if stack == nil {
+		stack = c.nearestStack(bucket)
+	}
+	matchStack := func() (*cloudformation.StackSummary, error) {
+		if stack != nil {
+			return stack, nil
+		}
+		deleted, err := c.loadDeletedStacks(ctx)
+		if err != nil {
+			*lookupErr = err
+			return nil, err
+		}
+		stack = nearestStackIn(bucket, deleted)
+		return stack, nil
+	}
+	return func(name string) (interface{}, error) {
+		switch name {
+		case "name":
+			return *bucket.Name, nil
+		case "region":
+			region, err := c.getBucketRegion(ctx, bucket)
+			if err != nil {
+				*lookupErr = err
+			}
+			return region, err
+		case "tags":
+			bucketTags, err := c.getBucketTags(ctx, bucket)
+			if err != nil {
+				*lookupErr = err
+				return nil, err
+			}
+			tags := map[string]string{}
+			for _, tag := range bucketTags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			return tags, nil
+		case "created":
+			return created.UTC().Format(time.RFC3339), nil
+		case "age_days":
+			return daysSince(created), nil
+		case "objects":
+			return float64(len(objects)), nil
+		case "size":
+			return float64((&PlannedBucket{Objects: objects}).Size()), nil
+		case "last_modified":
+			if newest.IsZero() {
+				return "", nil
+			}
+			return newest.UTC().Format(time.RFC3339), nil
+		case "idle_days":
+			if newest.IsZero() {
+				return daysSince(created), nil
+			}
+			return daysSince(newest), nil
+		case "stack_name", "stack_status":
+			stack, err := matchStack()
+			if err != nil || stack == nil {
+				return "", err
+			}
+			if name == "stack_name" {
+				return aws.StringValue(stack.StackName), nil
+			}
+			return aws.StringValue(stack.StackStatus), nil
+		}
+		return nil, fmt.Errorf("unknown attribute %q", name)
+	}
+}
+
+// policyReason vetoes deleting a bucket the policy expression does not
+// accept. An expression that fails to evaluate keeps the bucket.
+func (c *Cleaner) policyReason(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	decision *OwnershipDecision,
+	objects []*s3.Object,
+) (string, error) {
+	if c.policy == nil {
+		return "", nil
+	}
+	var lookupErr error
+	allowed, err := c.policy.evaluate(
+		c.bucketEnv(ctx, bucket, decision, objects, &lookupErr),
+	)
+	if lookupErr != nil {
+		return "", lookupErr
+	}
+	if err != nil {
+		return "policy error: " + err.Error(), nil
+	}
+	if !allowed {
+		return "policy " + c.policy.String() + " is false", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,134 @@
+package cleanup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestPolicyReason(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{
+		CreationDate: aws.Time(time.Now().Add(-40 * day)),
+		Name:         aws.String("teststack1-s3BucketTest"),
+	}
+	objects := []*s3.Object{
+		&s3.Object{
+			Key:          aws.String("a"),
+			Size:         aws.Int64(10),
+			LastModified: aws.Time(time.Now().Add(-35 * day)),
+		},
+	}
+	stack := &cloudformation.StackSummary{
+		StackName:   aws.String("teststack1"),
+		StackStatus: aws.String("UPDATE_COMPLETE"),
+	}
+	var tests = []struct {
+		policy   string
+		tags     bool
+		expected string
+	}{
+		{policy: ""},
+		{policy: `idle_days > 30 && age_days > 39 && objects == 1 && size == 10`},
+		{policy: `stack_name == "teststack1" && stack_status == "UPDATE_COMPLETE"`},
+		{policy: `created < last_modified && last_modified != ""`},
+		{policy: `tags["env"] != "prod"`, tags: true, expected: `policy tags["env"] != "prod" is false`},
+		{policy: `idle_days`, expected: "policy error: expected bool, got number"},
+	}
+	for _, test := range tests {
+		policy, err := parsePolicy(test.policy)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.policy, err)
+			continue
+		}
+		csbc := &Cleaner{
+			s3SVC:  mockS3Iface,
+			stacks: []*cloudformation.StackSummary{stack},
+			policy: policy,
+		}
+		if test.tags {
+			mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+				gomock.Any(),
+				&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+			).Return(
+				&s3.GetBucketTaggingOutput{
+					TagSet: []*s3.Tag{
+						&s3.Tag{Key: aws.String("env"), Value: aws.String("prod")},
+					},
+				},
+				nil,
+			)
+		}
+		result, err := csbc.policyReason(
+			context.Background(),
+			bucket,
+			&OwnershipDecision{},
+			objects,
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !strings.HasPrefix(result, test.expected) ||
+			(test.expected == "" && result != "") {
+			t.Errorf(
+				"%v: expected output of '%v' but got '%v'",
+				test.policy,
+				test.expected,
+				result,
+			)
+		}
+	}
+}
+
+func TestPolicyReasonMatchesDeletedStack(t *testing.T) {
+	mockCloudformationiface, _, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{
+		CreationDate: aws.Time(time.Now().Add(-40 * day)),
+		Name:         aws.String("oldstack-logs-1a2b3c4d"),
+	}
+	mockCloudformationiface.EXPECT().ListStacksWithContext(
+		gomock.Any(),
+		&cloudformation.ListStacksInput{
+			StackStatusFilter: aws.StringSlice(
+				[]string{cloudformation.StackStatusDeleteComplete},
+			),
+		},
+	).Return(
+		&cloudformation.ListStacksOutput{
+			StackSummaries: []*cloudformation.StackSummary{
+				&cloudformation.StackSummary{
+					StackName:    aws.String("oldstack"),
+					StackStatus:  aws.String(cloudformation.StackStatusDeleteComplete),
+					CreationTime: aws.Time(time.Now().Add(-41 * day)),
+				},
+			},
+		},
+		nil,
+	)
+	policy, err := parsePolicy(`stack_name == "oldstack" && stack_status == "DELETE_COMPLETE"`)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	csbc := &Cleaner{cfSVC: mockCloudformationiface, policy: policy}
+
+	reason, err := csbc.policyReason(context.Background(), bucket, &OwnershipDecision{}, nil)
+	if err != nil || reason != "" {
+		t.Errorf("Expected the deleted stack to match but got '%v' and %v", reason, err)
+	}
+}
+
+func TestParsePolicyRejectsUnknownAttributes(t *testing.T) {
+	if _, err := parsePolicy(`owner == "a"`); err == nil {
+		t.Errorf("Expected an error for an unknown attribute")
+	}
+}
@@ -0,0 +1,261 @@
+package cleanup
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const errCodeReplicationConfigurationNotFound = "ReplicationConfigurationNotFoundError"
+
+// bucketLinks indexes how the account's buckets point at each other,
+// keyed by bucket name. unreadable holds the buckets whose configuration
+// could not be read, with the error.
+type bucketLinks struct {
+	replicatesTo   map[string][]string
+	replicatedFrom map[string][]string
+	loggedFrom     map[string][]string
+	unreadable     map[string]string
+}
+
+// bucketNameFromArn accepts a bucket ARN or a plain bucket name.
+func bucketNameFromArn(arn string) string {
+	return strings.TrimPrefix(arn, "arn:aws:s3:::")
+}
+
+// bucketClient returns a client for the bucket's region, created once per
+// region, or the run's client without Options.S3ForRegion.
+func (c *Cleaner) bucketClient(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (s3iface.S3API, error) {
+	if c.s3ForRegion == nil {
+		return c.s3SVC, nil
+	}
+	region, err := c.getBucketRegion(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	client, ok := c.regionClients[region]
+	if !ok {
+		if c.regionClients == nil {
+			c.regionClients = map[string]s3iface.S3API{}
+		}
+		client = c.s3ForRegion(region)
+		c.regionClients[region] = client
+	}
+	return client, nil
+}
+
+func getReplicationDestinations(
+	ctx context.Context,
+	client s3iface.S3API,
+	bucket *s3.Bucket,
+) ([]string, error) {
+	resp, err := client.GetBucketReplicationWithContext(
+		ctx,
+		&s3.GetBucketReplicationInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if isAWSErrorCode(err, errCodeReplicationConfigurationNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.ReplicationConfiguration == nil {
+		return nil, nil
+	}
+	var destinations []string
+	for _, rule := range resp.ReplicationConfiguration.Rules {
+		if aws.StringValue(rule.Status) != s3.ReplicationRuleStatusEnabled ||
+			rule.Destination == nil {
+			continue
+		}
+		destination := bucketNameFromArn(aws.StringValue(rule.Destination.Bucket))
+		if !contains(destinations, destination) {
+			destinations = append(destinations, destination)
+		}
+	}
+	return destinations, nil
+}
+
+func getLoggingTarget(
+	ctx context.Context,
+	client s3iface.S3API,
+	bucket *s3.Bucket,
+) (string, error) {
+	resp, err := client.GetBucketLoggingWithContext(
+		ctx,
+		&s3.GetBucketLoggingInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	if resp.LoggingEnabled == nil {
+		return "", nil
+	}
+	return aws.StringValue(resp.LoggingEnabled.TargetBucket), nil
+}
+
+// getNotificationTargets returns the topics, queues and functions the
+// bucket sends event notifications to.
+func (c *Cleaner) getNotificationTargets(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) ([]string, error) {
+	client, err := c.bucketClient(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.GetBucketNotificationConfigurationWithContext(
+		ctx,
+		&s3.GetBucketNotificationConfigurationRequest{
+			Bucket: bucket.Name,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	for _, topic := range resp.TopicConfigurations {
+		targets = append(targets, aws.StringValue(topic.TopicArn))
+	}
+	for _, queue := range resp.QueueConfigurations {
+		targets = append(targets, aws.StringValue(queue.QueueArn))
+	}
+	for _, function := range resp.LambdaFunctionConfigurations {
+		targets = append(targets, aws.StringValue(function.LambdaFunctionArn))
+	}
+	return targets, nil
+}
+
+// addBucketLinks reads the replication and logging configuration of one
+// bucket through a client for its region.
+func (c *Cleaner) addBucketLinks(
+	ctx context.Context,
+	links *bucketLinks,
+	bucket *s3.Bucket,
+) error {
+	client, err := c.bucketClient(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	destinations, err := getReplicationDestinations(ctx, client, bucket)
+	if err != nil {
+		return err
+	}
+	target, err := getLoggingTarget(ctx, client, bucket)
+	if err != nil {
+		return err
+	}
+	for _, destination := range destinations {
+		links.replicatesTo[*bucket.Name] = append(links.replicatesTo[*bucket.Name], destination)
+		links.replicatedFrom[destination] = append(links.replicatedFrom[destination], *bucket.Name)
+	}
+	if target != "" && target != *bucket.Name {
+		links.loggedFrom[target] = append(links.loggedFrom[target], *bucket.Name)
+	}
+	return nil
+}
+
+// getBucketLinks reads the replication and logging configuration of
+// every bucket once per plan. A bucket that cannot be read is recorded as
+// unreadable rather than failing the plan.
+func (c *Cleaner) getBucketLinks(
+	ctx context.Context,
+	buckets []*s3.Bucket,
+) (*bucketLinks, error) {
+	if c.links != nil {
+		return c.links, nil
+	}
+	links := &bucketLinks{
+		replicatesTo:   map[string][]string{},
+		replicatedFrom: map[string][]string{},
+		loggedFrom:     map[string][]string{},
+		unreadable:     map[string]string{},
+	}
+	for _, bucket := range buckets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := c.addBucketLinks(ctx, links, bucket); err != nil {
+			c.log("Could not read the configuration of bucket ", *bucket.Name, ": ", err)
+			links.unreadable[*bucket.Name] = err.Error()
+		}
+	}
+	c.links = links
+	return links, nil
+}
+
+// linkReason refuses buckets that still receive server access logs from
+// other buckets, whatever Options.AllowDependents says: deleting one
+// silently stops their logging. While the configuration of another bucket
+// could not be read, its dependents are unknown and every bucket is
+// refused.
+func (c *Cleaner) linkReason(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	buckets []*s3.Bucket,
+) (string, error) {
+	links, err := c.getBucketLinks(ctx, buckets)
+	if err != nil {
+		return "", err
+	}
+	if len(links.unreadable) > 0 {
+		var names []string
+		for name := range links.unreadable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "unknown dependents, could not read bucket " + strings.Join(names, ", "), nil
+	}
+	sources := links.loggedFrom[*bucket.Name]
+	if len(sources) == 0 {
+		return "", nil
+	}
+	return "access log target of " + strings.Join(sources, ", "), nil
+}
+
+// bucketDependents lists what would break if the bucket went away:
+// replication it is the source or destination of and the targets of its
+// event notifications.
+func (c *Cleaner) bucketDependents(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	buckets []*s3.Bucket,
+) ([]string, error) {
+	links, err := c.getBucketLinks(ctx, buckets)
+	if err != nil {
+		return nil, err
+	}
+	var dependents []string
+	for _, destination := range links.replicatesTo[*bucket.Name] {
+		dependents = append(dependents, "replicates to "+destination)
+	}
+	for _, source := range links.replicatedFrom[*bucket.Name] {
+		dependents = append(dependents, "replica of "+source)
+	}
+	targets, err := c.getNotificationTargets(ctx, bucket)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return append(dependents, "notifies unknown targets ("+err.Error()+")"), nil
+	}
+	for _, target := range targets {
+		dependents = append(dependents, "notifies "+target)
+	}
+	return dependents, nil
+}
+
+func describeDependents(dependents []string) string {
+	return "has dependents: " + strings.Join(dependents, ", ")
+}
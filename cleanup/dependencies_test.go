@@ -0,0 +1,195 @@
+package cleanup
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/golang/mock/gomock"
+)
+
+func TestBucketDependents(t *testing.T) {
+	var tests = []struct {
+		replicatesTo string
+		replicaOf    bool
+		loggedFrom   bool
+		queue        string
+		expected     []string
+		reason       string
+	}{
+		{expected: nil},
+		{
+			replicatesTo: "arn:aws:s3:::team-a-logs-dr",
+			expected:     []string{"replicates to team-a-logs-dr"},
+		},
+		{replicaOf: true, expected: []string{"replica of team-a-web"}},
+		{loggedFrom: true, reason: "access log target of team-a-web"},
+		{
+			loggedFrom: true,
+			queue:      "arn:aws:sqs:us-east-1:123456789012:ingest",
+			expected:   []string{"notifies arn:aws:sqs:us-east-1:123456789012:ingest"},
+			reason:     "access log target of team-a-web",
+		},
+	}
+	for _, test := range tests {
+		_, mockS3Iface, ctrl := getMocks(t)
+
+		bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+		other := &s3.Bucket{Name: aws.String("team-a-web")}
+		csbc := &Cleaner{s3SVC: mockS3Iface}
+		replication := map[*s3.Bucket]string{bucket: test.replicatesTo}
+		if test.replicaOf {
+			replication[other] = "arn:aws:s3:::team-a-logs"
+		}
+		for _, b := range []*s3.Bucket{bucket, other} {
+			if replication[b] == "" {
+				mockS3Iface.EXPECT().GetBucketReplicationWithContext(
+					gomock.Any(),
+					&s3.GetBucketReplicationInput{Bucket: b.Name},
+				).Return(
+					nil,
+					awserr.New(errCodeReplicationConfigurationNotFound, "none", nil),
+				)
+				continue
+			}
+			mockS3Iface.EXPECT().GetBucketReplicationWithContext(
+				gomock.Any(),
+				&s3.GetBucketReplicationInput{Bucket: b.Name},
+			).Return(
+				&s3.GetBucketReplicationOutput{
+					ReplicationConfiguration: &s3.ReplicationConfiguration{
+						Rules: []*s3.ReplicationRule{
+							&s3.ReplicationRule{
+								Status:      aws.String(s3.ReplicationRuleStatusEnabled),
+								Destination: &s3.Destination{Bucket: aws.String(replication[b])},
+							},
+						},
+					},
+				},
+				nil,
+			)
+		}
+		mockS3Iface.EXPECT().GetBucketLoggingWithContext(
+			gomock.Any(),
+			&s3.GetBucketLoggingInput{Bucket: bucket.Name},
+		).Return(&s3.GetBucketLoggingOutput{}, nil)
+		logging := &s3.GetBucketLoggingOutput{}
+		if test.loggedFrom {
+			logging.LoggingEnabled = &s3.LoggingEnabled{TargetBucket: bucket.Name}
+		}
+		mockS3Iface.EXPECT().GetBucketLoggingWithContext(
+			gomock.Any(),
+			&s3.GetBucketLoggingInput{Bucket: other.Name},
+		).Return(logging, nil)
+		notifications := &s3.NotificationConfiguration{}
+		if test.queue != "" {
+			notifications.QueueConfigurations = []*s3.QueueConfiguration{
+				&s3.QueueConfiguration{QueueArn: aws.String(test.queue)},
+			}
+		}
+		mockS3Iface.EXPECT().GetBucketNotificationConfigurationWithContext(
+			gomock.Any(),
+			&s3.GetBucketNotificationConfigurationRequest{Bucket: bucket.Name},
+		).Return(notifications, nil)
+
+		buckets := []*s3.Bucket{bucket, other}
+		ctx := context.Background()
+		reason, err := csbc.linkReason(ctx, bucket, buckets)
+		if err != nil || reason != test.reason {
+			t.Errorf("Expected '%v' but got '%v' and %v", test.reason, reason, err)
+		}
+		dependents, err := csbc.bucketDependents(ctx, bucket, buckets)
+		if err != nil || !reflect.DeepEqual(dependents, test.expected) {
+			t.Errorf("Expected %v but got %v", test.expected, dependents)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestBucketLinksUseRegionalClients(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	_, mockRegionalS3Iface, regionalCtrl := getMocks(t)
+	defer regionalCtrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	other := &s3.Bucket{Name: aws.String("team-a-web")}
+	var regions []string
+	csbc := &Cleaner{
+		s3SVC: mockS3Iface,
+		s3ForRegion: func(region string) s3iface.S3API {
+			regions = append(regions, region)
+			return mockRegionalS3Iface
+		},
+	}
+	mockS3Iface.EXPECT().GetBucketLocationWithContext(
+		gomock.Any(),
+		&s3.GetBucketLocationInput{Bucket: bucket.Name},
+	).Return(
+		&s3.GetBucketLocationOutput{LocationConstraint: aws.String("eu-west-1")},
+		nil,
+	).Times(2)
+	mockS3Iface.EXPECT().GetBucketLocationWithContext(
+		gomock.Any(),
+		&s3.GetBucketLocationInput{Bucket: other.Name},
+	).Return(
+		&s3.GetBucketLocationOutput{LocationConstraint: aws.String("eu-west-1")},
+		nil,
+	)
+	for _, b := range []*s3.Bucket{bucket, other} {
+		mockRegionalS3Iface.EXPECT().GetBucketReplicationWithContext(
+			gomock.Any(),
+			&s3.GetBucketReplicationInput{Bucket: b.Name},
+		).Return(nil, awserr.New(errCodeReplicationConfigurationNotFound, "none", nil))
+		mockRegionalS3Iface.EXPECT().GetBucketLoggingWithContext(
+			gomock.Any(),
+			&s3.GetBucketLoggingInput{Bucket: b.Name},
+		).Return(&s3.GetBucketLoggingOutput{}, nil)
+	}
+	mockRegionalS3Iface.EXPECT().GetBucketNotificationConfigurationWithContext(
+		gomock.Any(),
+		&s3.GetBucketNotificationConfigurationRequest{Bucket: bucket.Name},
+	).Return(&s3.NotificationConfiguration{}, nil)
+
+	buckets := []*s3.Bucket{bucket, other}
+	ctx := context.Background()
+	if reason, err := csbc.linkReason(ctx, bucket, buckets); err != nil || reason != "" {
+		t.Errorf("Expected no reason but got '%v' and %v", reason, err)
+	}
+	if dependents, err := csbc.bucketDependents(ctx, bucket, buckets); err != nil || dependents != nil {
+		t.Errorf("Expected no dependents but got %v and %v", dependents, err)
+	}
+	if !reflect.DeepEqual(regions, []string{"eu-west-1"}) {
+		t.Errorf("Expected one client for eu-west-1 but got %v", regions)
+	}
+}
+
+func TestUnreadableBucketKeepsCandidates(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	other := &s3.Bucket{Name: aws.String("team-a-web")}
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	mockS3Iface.EXPECT().GetBucketReplicationWithContext(
+		gomock.Any(),
+		&s3.GetBucketReplicationInput{Bucket: bucket.Name},
+	).Return(nil, awserr.New(errCodeReplicationConfigurationNotFound, "none", nil))
+	mockS3Iface.EXPECT().GetBucketLoggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketLoggingInput{Bucket: bucket.Name},
+	).Return(&s3.GetBucketLoggingOutput{}, nil)
+	mockS3Iface.EXPECT().GetBucketReplicationWithContext(
+		gomock.Any(),
+		&s3.GetBucketReplicationInput{Bucket: other.Name},
+	).Return(nil, awserr.New("AccessDenied", "denied", nil))
+
+	reason, err := csbc.linkReason(context.Background(), bucket, []*s3.Bucket{bucket, other})
+	if err != nil || reason != "unknown dependents, could not read bucket team-a-web" {
+		t.Errorf("Expected the bucket to be kept but got '%v' and %v", reason, err)
+	}
+}
@@ -0,0 +1,72 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func findBucket(
+	buckets []*s3.Bucket,
+	bucketName string,
+) *s3.Bucket {
+	for _, bucket := range buckets {
+		if *bucket.Name == bucketName {
+			return bucket
+		}
+	}
+	return nil
+}
+
+// describeVerdict turns decideBucket's conclusion into the line explain
+// prints.
+func (c *Cleaner) describeVerdict(verdict *bucketVerdict) string {
+	if !verdict.candidate {
+		if len(c.bucketPatterns) > 0 {
+			return "keep, not matched by rule " + c.ruleName
+		}
+		return "keep, not matched by bucket filter " + c.bucketFilter
+	}
+	if verdict.outcome == "" {
+		return "delete"
+	}
+	return "keep, " + verdict.reason
+}
+
+// explain prints the ownership evidence for a bucket and the verdict a
+// run would reach.
+func (c *Cleaner) explain(
+	ctx context.Context,
+	out io.Writer,
+	bucketName string,
+) error {
+	buckets, err := c.listBuckets(ctx)
+	if err != nil {
+		return err
+	}
+	bucket := findBucket(buckets, bucketName)
+	if bucket == nil {
+		return fmt.Errorf("bucket %q not found", bucketName)
+	}
+	verdict, err := c.decideBucket(ctx, bucket, buckets)
+	if err != nil {
+		return err
+	}
+	decision := verdict.decision
+	if decision == nil {
+		if decision, err = c.decideOwnership(ctx, bucket); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "Bucket: %s\n", bucketName)
+	fmt.Fprintf(out, "Strategy: %s\n", c.ownershipStrategy().Name())
+	for _, evidence := range decision.Evidence {
+		fmt.Fprintf(out, "  %s\n", evidence)
+	}
+	fmt.Fprintf(out, "Ownership: %s\n", decision.Verdict)
+	fmt.Fprintf(out, "Verdict: %s\n", c.describeVerdict(verdict))
+	return nil
+}
@@ -0,0 +1,114 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestExplain(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	expectBucketConfiguration(mockS3Iface)
+
+	bucket := &s3.Bucket{
+		Name:         aws.String("teststack1-s3BucketTest"),
+		CreationDate: getTimeSecondsBeforeNow(5000),
+	}
+	csbc := &Cleaner{
+		s3SVC:        mockS3Iface,
+		stacks:       getOwnershipTestStacks(),
+		bucketFilter: "s3BucketTest",
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Times(2).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket}},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: bucket.Name},
+	).Return(&s3.ListObjectsOutput{}, nil)
+
+	var out bytes.Buffer
+	if err := csbc.explain(context.Background(), &out, *bucket.Name); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	for _, expected := range []string{
+		"stack resource",
+		"cloudformation tags",
+		"name",
+		"creation time",
+		"recent activity",
+		"Score: 20 (threshold 50)",
+		"Verdict: delete",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %q but got:\n%v", expected, out.String())
+		}
+	}
+
+	if err := csbc.explain(context.Background(), &out, "missing"); err == nil {
+		t.Errorf("Expected an error for a missing bucket")
+	}
+}
+
+func TestExplainSharesPlanChecks(t *testing.T) {
+	var tests = []struct {
+		strategy   OwnershipStrategy
+		loggedFrom bool
+		expected   string
+	}{
+		{loggedFrom: true, expected: "Verdict: keep, access log target of team-a-web"},
+		{strategy: &stackResourceStrategy{}, expected: "Verdict: keep, unknown (stack-resource)"},
+	}
+	for _, test := range tests {
+		_, mockS3Iface, ctrl := getMocks(t)
+
+		bucket := &s3.Bucket{
+			Name:         aws.String("teststack1-s3BucketTest"),
+			CreationDate: getTimeSecondsBeforeNow(5000),
+		}
+		other := &s3.Bucket{Name: aws.String("team-a-web")}
+		csbc := &Cleaner{
+			s3SVC:        mockS3Iface,
+			stacks:       getOwnershipTestStacks(),
+			bucketFilter: "s3BucketTest",
+			strategy:     test.strategy,
+		}
+		mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+			&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket, other}},
+			nil,
+		)
+		if test.loggedFrom {
+			mockS3Iface.EXPECT().GetBucketLoggingWithContext(
+				gomock.Any(),
+				&s3.GetBucketLoggingInput{Bucket: other.Name},
+			).Return(
+				&s3.GetBucketLoggingOutput{
+					LoggingEnabled: &s3.LoggingEnabled{TargetBucket: bucket.Name},
+				},
+				nil,
+			)
+		} else {
+			mockS3Iface.EXPECT().ListObjectsWithContext(
+				gomock.Any(),
+				&s3.ListObjectsInput{Bucket: bucket.Name},
+			).Return(&s3.ListObjectsOutput{}, nil)
+		}
+		expectBucketConfiguration(mockS3Iface)
+
+		var out bytes.Buffer
+		if err := csbc.explain(context.Background(), &out, *bucket.Name); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !strings.Contains(out.String(), test.expected) {
+			t.Errorf("Expected output to contain %q but got:\n%v", test.expected, out.String())
+		}
+		ctrl.Finish()
+	}
+}
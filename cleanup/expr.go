@@ -0,0 +1,587 @@
+package cleanup
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A small expression language for deletion policies, e.g.
+//
+//	tags["env"] != "prod" && idle_days > 30
+//
+// Values are numbers (float64), strings, booleans and string maps (tags).
+// Operators, loosest first: ||, &&, comparisons and in, then ! and unary -.
+
+const (
+	tokenEOF = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+var exprOperators = []string{
+	"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "-", "(", ")", "[", "]", ",",
+}
+
+type exprToken struct {
+	kind   int
+	text   string
+	offset int
+}
+
+type exprFunction func(args []interface{}) (interface{}, error)
+
+var exprFunctions = map[string]exprFunction{
+	"contains":   stringPredicate(strings.Contains),
+	"startsWith": stringPredicate(strings.HasPrefix),
+	"endsWith":   stringPredicate(strings.HasSuffix),
+	"matches": func(args []interface{}) (interface{}, error) {
+		s, pattern, err := stringArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	},
+	"lower": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expects 1 argument, got %d", len(args))
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expects a string, got %s", typeName(args[0]))
+		}
+		return strings.ToLower(s), nil
+	},
+}
+
+func stringArgs(args []interface{}) (string, string, error) {
+	if len(args) != 2 {
+		return "", "", fmt.Errorf("expects 2 arguments, got %d", len(args))
+	}
+	a, okA := args[0].(string)
+	b, okB := args[1].(string)
+	if !okA || !okB {
+		return "", "", fmt.Errorf(
+			"expects strings, got %s and %s",
+			typeName(args[0]),
+			typeName(args[1]),
+		)
+	}
+	return a, b, nil
+}
+
+func stringPredicate(predicate func(string, string) bool) exprFunction {
+	return func(args []interface{}) (interface{}, error) {
+		a, b, err := stringArgs(args)
+		if err != nil {
+			return nil, err
+		}
+		return predicate(a, b), nil
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case map[string]string:
+		return "map"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func tokenize(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(source); {
+		r := rune(source[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokenNumber, source[start:i], start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(source) && (source[i] == '_' ||
+				unicode.IsLetter(rune(source[i])) ||
+				unicode.IsDigit(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokenIdent, source[start:i], start})
+		case r == '"':
+			start := i
+			for i++; i < len(source) && source[i] != '"'; i++ {
+				if source[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(source) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			text, err := strconv.Unquote(source[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("bad string at offset %d: %v", start, err)
+			}
+			tokens = append(tokens, exprToken{tokenString, text, start})
+		default:
+			operator := ""
+			for _, op := range exprOperators {
+				if strings.HasPrefix(source[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected %q at offset %d", r, i)
+			}
+			tokens = append(tokens, exprToken{tokenOperator, operator, i})
+			i += len(operator)
+		}
+	}
+	return append(tokens, exprToken{tokenEOF, "", len(source)}), nil
+}
+
+// exprEnv resolves an attribute name to its value. Attributes are looked up
+// lazily so an expression only costs the API calls it needs.
+type exprEnv func(name string) (interface{}, error)
+
+type exprNode interface {
+	eval(env exprEnv) (interface{}, error)
+}
+
+type literalNode struct{ value interface{} }
+
+type attributeNode struct{ name string }
+
+type unaryNode struct {
+	operator string
+	operand  exprNode
+}
+
+type binaryNode struct {
+	operator    string
+	left, right exprNode
+}
+
+type indexNode struct{ target, key exprNode }
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+// expression is a parsed policy, ready to be evaluated per bucket.
+type expression struct {
+	source string
+	root   exprNode
+}
+
+type exprParser struct {
+	tokens     []exprToken
+	pos        int
+	attributes map[string]bool
+}
+
+// parseExpression compiles source, rejecting attributes outside the given
+// set. An empty source yields a nil expression.
+func parseExpression(
+	source string,
+	attributes map[string]bool,
+) (*expression, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %q: %v", source, err)
+	}
+	p := &exprParser{tokens: tokens, attributes: attributes}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %q: %v", source, err)
+	}
+	return &expression{source: source, root: root}, nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *exprParser) accept(operators ...string) (string, bool) {
+	token := p.peek()
+	if token.kind != tokenOperator && !(token.kind == tokenIdent && token.text == "in") {
+		return "", false
+	}
+	for _, op := range operators {
+		if token.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(operator string) error {
+	if _, ok := p.accept(operator); !ok {
+		return p.errorf("expected %q", operator)
+	}
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(
+		format+" at offset %d",
+		append(args, p.peek().offset)...,
+	)
+}
+
+func (p *exprParser) parseBinary(
+	operand func() (exprNode, error),
+	operators ...string,
+) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(operators...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseComparison, "&&")
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{operator: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{operator: op, operand: operand}, nil
+	}
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("["); !ok {
+			return node, nil
+		}
+		key, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		node = &indexNode{target: node, key: key}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	token := p.peek()
+	switch token.kind {
+	case tokenNumber:
+		p.next()
+		value, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at offset %d", token.text, token.offset)
+		}
+		return &literalNode{value}, nil
+	case tokenString:
+		p.next()
+		return &literalNode{token.text}, nil
+	case tokenIdent:
+		p.next()
+		switch token.text {
+		case "true":
+			return &literalNode{true}, nil
+		case "false":
+			return &literalNode{false}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(token)
+		}
+		if !p.attributes[token.text] {
+			return nil, fmt.Errorf(
+				"unknown attribute %q at offset %d",
+				token.text,
+				token.offset,
+			)
+		}
+		return &attributeNode{token.text}, nil
+	}
+	if _, ok := p.accept("("); ok {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")")
+	}
+	if token.kind == tokenEOF {
+		return nil, p.errorf("unexpected end of policy")
+	}
+	return nil, p.errorf("unexpected %q", token.text)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	if _, ok := exprFunctions[name.text]; !ok {
+		return nil, fmt.Errorf(
+			"unknown function %q at offset %d",
+			name.text,
+			name.offset,
+		)
+	}
+	call := &callNode{name: name.text}
+	if _, ok := p.accept(")"); ok {
+		return call, nil
+	}
+	for {
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if _, ok := p.accept(","); !ok {
+			return call, p.expect(")")
+		}
+	}
+}
+
+func (n *literalNode) eval(env exprEnv) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *attributeNode) eval(env exprEnv) (interface{}, error) {
+	return env(n.name)
+}
+
+func (n *unaryNode) eval(env exprEnv) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case bool:
+		if n.operator == "!" {
+			return !v, nil
+		}
+	case float64:
+		if n.operator == "-" {
+			return -v, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot apply %s to %s", n.operator, typeName(value))
+}
+
+func evalBool(node exprNode, env exprEnv) (bool, error) {
+	value, err := node.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected bool, got %s", typeName(value))
+	}
+	return b, nil
+}
+
+func (n *binaryNode) eval(env exprEnv) (interface{}, error) {
+	switch n.operator {
+	case "&&", "||":
+		left, err := evalBool(n.left, env)
+		if err != nil || left == (n.operator == "||") {
+			return left, err
+		}
+		return evalBool(n.right, env)
+	}
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.operator == "in" {
+		return evalIn(left, right)
+	}
+	return compare(n.operator, left, right)
+}
+
+func evalIn(left, right interface{}) (interface{}, error) {
+	key, ok := left.(string)
+	if ok {
+		switch container := right.(type) {
+		case map[string]string:
+			_, found := container[key]
+			return found, nil
+		case string:
+			return strings.Contains(container, key), nil
+		}
+	}
+	return nil, fmt.Errorf(
+		"cannot test %s in %s",
+		typeName(left),
+		typeName(right),
+	)
+}
+
+func compare(operator string, left, right interface{}) (interface{}, error) {
+	var order int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			break
+		}
+		switch {
+		case l < r:
+			order = -1
+		case l > r:
+			order = 1
+		}
+		return ordered(operator, order), nil
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			break
+		}
+		return ordered(operator, strings.Compare(l, r)), nil
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			break
+		}
+		switch operator {
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		}
+	}
+	return nil, fmt.Errorf(
+		"cannot compare %s %s %s",
+		typeName(left),
+		operator,
+		typeName(right),
+	)
+}
+
+func ordered(operator string, order int) bool {
+	switch operator {
+	case "==":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	}
+	return order >= 0
+}
+
+func (n *indexNode) eval(env exprEnv) (interface{}, error) {
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := target.(map[string]string)
+	k, okKey := key.(string)
+	if !ok || !okKey {
+		return nil, fmt.Errorf(
+			"cannot index %s with %s",
+			typeName(target),
+			typeName(key),
+		)
+	}
+	return m[k], nil
+}
+
+func (n *callNode) eval(env exprEnv) (interface{}, error) {
+	var args []interface{}
+	for _, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	result, err := exprFunctions[n.name](args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.name, err)
+	}
+	return result, nil
+}
+
+// evaluate runs the expression, which must produce a bool.
+func (e *expression) evaluate(env exprEnv) (bool, error) {
+	return evalBool(e.root, env)
+}
+
+func (e *expression) String() string {
+	return e.source
+}
@@ -0,0 +1,137 @@
+package cleanup
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func getTestEnv() exprEnv {
+	values := map[string]interface{}{
+		"name":      "teststack1-s3buckettest",
+		"idle_days": 45.5,
+		"objects":   12.0,
+		"tags":      map[string]string{"env": "dev", "team": "a"},
+	}
+	return func(name string) (interface{}, error) {
+		value, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute %q", name)
+		}
+		return value, nil
+	}
+}
+
+var testAttributes = map[string]bool{
+	"name":      true,
+	"idle_days": true,
+	"objects":   true,
+	"tags":      true,
+}
+
+func TestExpressionEvaluate(t *testing.T) {
+	var tests = []struct {
+		source   string
+		expected bool
+	}{
+		{source: `tags["env"] != "prod" && idle_days > 30`, expected: true},
+		{source: `tags["env"] == "prod" || idle_days > 60`, expected: false},
+		{source: `!(objects >= 12)`, expected: false},
+		{source: `objects < 12.5 && -objects <= -12`, expected: true},
+		{source: `tags["owner"] == ""`, expected: true},
+		{source: `"team" in tags && !("owner" in tags)`, expected: true},
+		{source: `"s3bucket" in name`, expected: true},
+		{source: `startsWith(name, "teststack") && endsWith(name, "test")`, expected: true},
+		{source: `contains(lower("ABC"), "b")`, expected: true},
+		{source: `matches(name, "^teststack[0-9]+-")`, expected: true},
+		{source: `name < "u"`, expected: true},
+		{source: `true == (1 == 1)`, expected: true},
+		{source: `"a\"b" == "a\"b"`, expected: true},
+	}
+	for _, test := range tests {
+		expr, err := parseExpression(test.source, testAttributes)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.source, err)
+			continue
+		}
+		result, err := expr.evaluate(getTestEnv())
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.source, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf(
+				"%v: expected output of '%v' but got '%v'",
+				test.source,
+				test.expected,
+				result,
+			)
+		}
+	}
+}
+
+func TestExpressionShortCircuit(t *testing.T) {
+	expr, err := parseExpression(`false && tags["env"] == "dev"`, testAttributes)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	result, err := expr.evaluate(func(name string) (interface{}, error) {
+		t.Errorf("Expected %v not to be looked up", name)
+		return nil, nil
+	})
+	if result || err != nil {
+		t.Errorf("Expected false without error but got %v and %v", result, err)
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	var tests = []struct {
+		source   string
+		expected string
+	}{
+		{source: `owner == "a"`, expected: `unknown attribute "owner" at offset 0`},
+		{source: `size(name)`, expected: `unknown function "size"`},
+		{source: `idle_days > `, expected: "unexpected end of policy"},
+		{source: `(idle_days > 1`, expected: `expected ")"`},
+		{source: `name == "a`, expected: "unterminated string"},
+		{source: `name = "a"`, expected: `unexpected '='`},
+		{source: `idle_days > 1 1`, expected: `unexpected "1"`},
+		{source: `objects > 1.2.3`, expected: "bad number"},
+	}
+	for _, test := range tests {
+		_, err := parseExpression(test.source, testAttributes)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%v: expected error '%v' but got '%v'", test.source, test.expected, err)
+		}
+	}
+	if expr, err := parseExpression(" ", testAttributes); expr != nil || err != nil {
+		t.Errorf("Expected no expression for an empty policy")
+	}
+}
+
+func TestExpressionEvaluateErrors(t *testing.T) {
+	var tests = []struct {
+		source   string
+		expected string
+	}{
+		{source: `objects`, expected: "expected bool, got number"},
+		{source: `name > 1`, expected: "cannot compare string > number"},
+		{source: `tags == "a"`, expected: "cannot compare map == string"},
+		{source: `-name == "a"`, expected: "cannot apply - to string"},
+		{source: `name["a"] == ""`, expected: "cannot index string"},
+		{source: `1 in tags`, expected: "cannot test number in map"},
+		{source: `matches(name, "(")`, expected: "matches:"},
+		{source: `contains(name)`, expected: "contains: expects 2 arguments"},
+	}
+	for _, test := range tests {
+		expr, err := parseExpression(test.source, testAttributes)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.source, err)
+			continue
+		}
+		_, err = expr.evaluate(getTestEnv())
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%v: expected error '%v' but got '%v'", test.source, test.expected, err)
+		}
+	}
+}
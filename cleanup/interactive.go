@@ -0,0 +1,90 @@
+package cleanup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	answerApprove = iota
+	answerSkip
+	answerApproveAll
+	answerQuit
+)
+
+// Prompter asks the operator to approve each planned bucket before it is
+// deleted.
+type Prompter struct {
+	in         *bufio.Reader
+	out        io.Writer
+	approveAll bool
+}
+
+// NewPrompter returns a Prompter reading answers from in and writing
+// questions to out.
+func NewPrompter(in io.Reader, out io.Writer) *Prompter {
+	return &Prompter{in: bufio.NewReader(in), out: out}
+}
+
+func parseAnswer(answer string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return answerApprove, true
+	case "n", "no", "s", "skip":
+		return answerSkip, true
+	case "a", "all":
+		return answerApproveAll, true
+	case "q", "quit":
+		return answerQuit, true
+	}
+	return 0, false
+}
+
+func (p *Prompter) confirm(description string, action string) int {
+	if p.approveAll {
+		return answerApprove
+	}
+	fmt.Fprintln(p.out, description)
+	for {
+		fmt.Fprintf(p.out, "Apply %s to this bucket? [y]es/[n]o/[a]ll/[q]uit: ", action)
+		line, err := p.in.ReadString('\n')
+		if answer, ok := parseAnswer(line); ok {
+			if answer == answerApproveAll {
+				p.approveAll = true
+			}
+			return answer
+		}
+		if err != nil {
+			return answerQuit
+		}
+	}
+}
+
+func (c *Cleaner) describePlannedBucket(planned *PlannedBucket) string {
+	stack := "none"
+	if nearest := c.nearestStack(planned.Bucket); nearest != nil {
+		stack = fmt.Sprintf(
+			"%s (%s, created %s)",
+			c.describeStack(nearest),
+			aws.StringValue(nearest.StackStatus),
+			aws.TimeValue(nearest.CreationTime).Format(time.RFC3339),
+		)
+	}
+	description := fmt.Sprintf(
+		"Bucket:  %s\nObjects: %d\nSize:    %d bytes\nCreated: %s\nStack:   %s",
+		*planned.Bucket.Name,
+		len(planned.Objects),
+		planned.Size(),
+		aws.TimeValue(planned.Bucket.CreationDate).Format(time.RFC3339),
+		stack,
+	)
+	if len(planned.Dependents) > 0 {
+		description += "\nDepends: " + strings.Join(planned.Dependents, ", ")
+	}
+	return description
+}
@@ -0,0 +1,109 @@
+package cleanup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestPrompterConfirm(t *testing.T) {
+	var out bytes.Buffer
+	prompter := NewPrompter(strings.NewReader("maybe\nn\na\n"), &out)
+
+	if answer := prompter.confirm("bucket1", ActionDelete); answer != answerSkip {
+		t.Errorf("Expected answer %v but got %v", answerSkip, answer)
+	}
+	if answer := prompter.confirm("bucket2", ActionDelete); answer != answerApproveAll {
+		t.Errorf("Expected answer %v but got %v", answerApproveAll, answer)
+	}
+	if answer := prompter.confirm("bucket3", ActionDelete); answer != answerApprove {
+		t.Errorf("Expected answer %v but got %v", answerApprove, answer)
+	}
+	if strings.Contains(out.String(), "bucket3") {
+		t.Errorf("Expected no prompt once all buckets were approved")
+	}
+
+	eof := NewPrompter(strings.NewReader(""), &out)
+	if answer := eof.confirm("bucket4", ActionDelete); answer != answerQuit {
+		t.Errorf("Expected answer %v on end of input but got %v", answerQuit, answer)
+	}
+}
+
+func TestNearestStack(t *testing.T) {
+	csbc := &Cleaner{
+		stacks: []*cloudformation.StackSummary{
+			&cloudformation.StackSummary{
+				StackName:    aws.String("teststack1"),
+				CreationTime: getTimeSecondsBeforeNow(5000),
+			},
+			&cloudformation.StackSummary{
+				StackName:    aws.String("teststack1"),
+				CreationTime: getTimeSecondsBeforeNow(1000),
+			},
+			&cloudformation.StackSummary{
+				StackName:    aws.String("otherstack"),
+				CreationTime: getTimeSecondsBeforeNow(900),
+			},
+		},
+	}
+	planned := &PlannedBucket{
+		Bucket: &s3.Bucket{
+			Name:         aws.String("teststack1-s3BucketTest"),
+			CreationDate: getTimeSecondsBeforeNow(800),
+		},
+	}
+	nearest := csbc.nearestStack(planned.Bucket)
+	if nearest != csbc.stacks[1] {
+		t.Errorf("Expected the second stack but got %v", nearest)
+	}
+	if !strings.Contains(csbc.describePlannedBucket(planned), "teststack1") {
+		t.Errorf("Expected the description to name the nearest stack")
+	}
+}
+
+func TestRemoveUnusedCFBucketsInteractive(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	expectBucketConfiguration(mockS3Iface)
+
+	bucket1 := &s3.Bucket{
+		CreationDate: getTimeSecondsBeforeNow(300),
+		Name:         aws.String("testS3Removal1s3BucketTest"),
+	}
+	bucket2 := &s3.Bucket{
+		CreationDate: getTimeSecondsBeforeNow(300),
+		Name:         aws.String("testS3Removal2s3BucketTest"),
+	}
+	csbc := &Cleaner{
+		s3SVC:        mockS3Iface,
+		bucketFilter: "s3BucketTest",
+		prompter: NewPrompter(
+			strings.NewReader("n\ny\n"),
+			&bytes.Buffer{},
+		),
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket1, bucket2}},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(gomock.Any(), gomock.Any()).Times(2).Return(
+		&s3.ListObjectsOutput{Contents: []*s3.Object{}},
+		nil,
+	)
+	mockS3Iface.EXPECT().DeleteBucketWithContext(
+		gomock.Any(),
+		&s3.DeleteBucketInput{Bucket: bucket2.Name},
+	).Return(&s3.DeleteBucketOutput{}, nil)
+
+	runRemoval(t, csbc)
+	if len(csbc.report) != 2 ||
+		csbc.report[0].Outcome != OutcomeSkipped ||
+		csbc.report[1].Outcome != OutcomeDeleted {
+		t.Errorf("Expected one skipped and one deleted bucket but got %v", csbc.report)
+	}
+}
@@ -0,0 +1,358 @@
+package cleanup
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// maxInventoryAge is how old an inventory may be before the bucket is
+	// listed instead.
+	maxInventoryAge = 7 * day
+
+	errCodeNoSuchKey = "NoSuchKey"
+)
+
+var inventoryDatePattern = regexp.MustCompile(`/\d{4}-\d{2}-\d{2}T\d{2}-\d{2}Z/$`)
+
+// inventoryManifest is the manifest.json S3 Inventory writes with every
+// report.
+type inventoryManifest struct {
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	CreationTimestamp string `json:"creationTimestamp"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+func (m *inventoryManifest) created() time.Time {
+	millis, _ := strconv.ParseInt(m.CreationTimestamp, 10, 64)
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// getInventoryDestination returns where the bucket's first enabled CSV
+// inventory is delivered, as the destination bucket and the prefix its
+// reports are written under.
+func (c *Cleaner) getInventoryDestination(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (string, string, error) {
+	var token *string
+	for {
+		resp, err := c.s3SVC.ListBucketInventoryConfigurationsWithContext(
+			ctx,
+			&s3.ListBucketInventoryConfigurationsInput{
+				Bucket:            bucket.Name,
+				ContinuationToken: token,
+			},
+		)
+		if err != nil {
+			return "", "", err
+		}
+		for _, config := range resp.InventoryConfigurationList {
+			if !aws.BoolValue(config.IsEnabled) ||
+				config.Destination == nil ||
+				config.Destination.S3BucketDestination == nil {
+				continue
+			}
+			destination := config.Destination.S3BucketDestination
+			if aws.StringValue(destination.Format) != s3.InventoryFormatCsv {
+				c.log(
+					"Skipping ", aws.StringValue(destination.Format),
+					" inventory ", aws.StringValue(config.Id),
+					" of bucket ", *bucket.Name, ": only CSV is supported",
+				)
+				continue
+			}
+			prefix := *bucket.Name + "/" + aws.StringValue(config.Id) + "/"
+			if aws.StringValue(destination.Prefix) != "" {
+				prefix = strings.TrimSuffix(*destination.Prefix, "/") + "/" + prefix
+			}
+			name := strings.TrimPrefix(aws.StringValue(destination.Bucket), "arn:aws:s3:::")
+			return name, prefix, nil
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			return "", "", nil
+		}
+		token = resp.NextContinuationToken
+	}
+}
+
+// getInventoryDates lists the dated report folders under prefix, newest
+// first.
+func (c *Cleaner) getInventoryDates(
+	ctx context.Context,
+	destination string,
+	prefix string,
+) ([]string, error) {
+	var (
+		dates  []string
+		marker *string
+	)
+	for {
+		resp, err := c.s3SVC.ListObjectsWithContext(
+			ctx,
+			&s3.ListObjectsInput{
+				Bucket:    aws.String(destination),
+				Prefix:    aws.String(prefix),
+				Delimiter: aws.String("/"),
+				Marker:    marker,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, common := range resp.CommonPrefixes {
+			if inventoryDatePattern.MatchString(aws.StringValue(common.Prefix)) {
+				dates = append(dates, *common.Prefix)
+			}
+		}
+		if !aws.BoolValue(resp.IsTruncated) || resp.NextMarker == nil {
+			break
+		}
+		marker = resp.NextMarker
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+	return dates, nil
+}
+
+func (c *Cleaner) getObjectBody(
+	ctx context.Context,
+	bucket string,
+	key string,
+) (io.ReadCloser, error) {
+	resp, err := c.s3SVC.GetObjectWithContext(
+		ctx,
+		&s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		},
+	)
+	if isAWSErrorCode(err, errCodeNoSuchKey) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// getLatestManifest returns the newest complete report. A report folder
+// without a manifest is still being written.
+func (c *Cleaner) getLatestManifest(
+	ctx context.Context,
+	destination string,
+	prefix string,
+) (*inventoryManifest, error) {
+	dates, err := c.getInventoryDates(ctx, destination, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, date := range dates {
+		body, err := c.getObjectBody(ctx, destination, date+"manifest.json")
+		if err != nil {
+			return nil, err
+		}
+		if body == nil {
+			continue
+		}
+		manifest := &inventoryManifest{}
+		err = json.NewDecoder(body).Decode(manifest)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		return manifest, nil
+	}
+	return nil, nil
+}
+
+// readInventoryFile adds the rows of one gzip CSV data file to planned.
+func (c *Cleaner) readInventoryFile(
+	ctx context.Context,
+	planned *PlannedBucket,
+	destination string,
+	key string,
+	schema []string,
+) error {
+	body, err := c.getObjectBody(ctx, destination, key)
+	if err != nil {
+		return err
+	}
+	if body == nil {
+		return fmt.Errorf("inventory data file %s is missing", key)
+	}
+	defer body.Close()
+	var reader io.Reader = body
+	if strings.HasSuffix(key, ".gz") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	records := csv.NewReader(reader)
+	records.FieldsPerRecord = len(schema)
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		row := map[string]string{}
+		for i, field := range schema {
+			row[field] = record[i]
+		}
+		objectKey, err := url.QueryUnescape(row["Key"])
+		if err != nil {
+			return err
+		}
+		if _, versioned := row["VersionId"]; versioned {
+			versionID := row["VersionId"]
+			if versionID == "" {
+				versionID = "null"
+			}
+			planned.Versions = append(
+				planned.Versions,
+				&s3.ObjectIdentifier{
+					Key:       aws.String(objectKey),
+					VersionId: aws.String(versionID),
+				},
+			)
+		}
+		if row["IsLatest"] == "false" || row["IsDeleteMarker"] == "true" {
+			continue
+		}
+		object := &s3.Object{Key: aws.String(objectKey)}
+		if size, err := strconv.ParseInt(row["Size"], 10, 64); err == nil {
+			object.Size = aws.Int64(size)
+		}
+		if modified, err := time.Parse(time.RFC3339, row["LastModifiedDate"]); err == nil {
+			object.LastModified = aws.Time(modified)
+		}
+		planned.Objects = append(planned.Objects, object)
+	}
+}
+
+// getInventoryListing reads the bucket's contents from its latest CSV
+// inventory. It returns nil when the bucket has to be listed instead.
+func (c *Cleaner) getInventoryListing(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (*PlannedBucket, error) {
+	destination, prefix, err := c.getInventoryDestination(ctx, bucket)
+	if err != nil || destination == "" {
+		return nil, err
+	}
+	manifest, err := c.getLatestManifest(ctx, destination, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		c.log("No inventory report yet for bucket ", *bucket.Name)
+		return nil, nil
+	}
+	if manifest.FileFormat != s3.InventoryFormatCsv {
+		return nil, nil
+	}
+	created := manifest.created()
+	// The idle safeguard judges activity from the report, which can only
+	// show a bucket idle for MinIdleAge if it is newer than that.
+	maxAge := maxInventoryAge
+	if c.minIdleAge > 0 && c.minIdleAge < maxAge {
+		maxAge = c.minIdleAge
+	}
+	if time.Since(created) > maxAge {
+		c.log(
+			"Inventory of bucket ", *bucket.Name,
+			" is ", formatDays(time.Since(created)), " old, listing instead",
+		)
+		return nil, nil
+	}
+	var schema []string
+	for _, field := range strings.Split(manifest.FileSchema, ",") {
+		schema = append(schema, strings.TrimSpace(field))
+	}
+	planned := &PlannedBucket{Bucket: bucket, InventoryDate: created}
+	for _, file := range manifest.Files {
+		err := c.readInventoryFile(ctx, planned, destination, file.Key, schema)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.log(
+		"Read ", len(planned.Objects), " objects of bucket ", *bucket.Name,
+		" from the inventory of ", created.UTC().Format(time.RFC3339),
+	)
+	if err := c.addMissingObjects(ctx, planned); err != nil {
+		return nil, err
+	}
+	return planned, nil
+}
+
+// addMissingObjects lists the bucket for the objects the inventory does
+// not include, mostly ones written after it was taken, and adds them to
+// planned so inventoryReason can judge them before anything is deleted.
+func (c *Cleaner) addMissingObjects(ctx context.Context, planned *PlannedBucket) error {
+	objects, err := c.listObjects(ctx, planned.Bucket)
+	if err != nil {
+		return err
+	}
+	inventoried := make(map[string]bool, len(planned.Objects))
+	for _, object := range planned.Objects {
+		inventoried[*object.Key] = true
+	}
+	for _, object := range objects {
+		if !inventoried[*object.Key] ||
+			aws.TimeValue(object.LastModified).After(planned.InventoryDate) {
+			planned.Missing = append(planned.Missing, object)
+		}
+	}
+	planned.Objects = append(planned.Objects, planned.Missing...)
+	return nil
+}
+
+// writtenSince counts the objects modified after since.
+func writtenSince(objects []*s3.Object, since time.Time) int {
+	written := 0
+	for _, object := range objects {
+		if aws.TimeValue(object.LastModified).After(since) {
+			written++
+		}
+	}
+	return written
+}
+
+// inventoryReason keeps a bucket written to after its inventory was taken,
+// as it is still in use.
+func inventoryReason(planned *PlannedBucket) string {
+	if planned.InventoryDate.IsZero() {
+		return ""
+	}
+	written := writtenSince(planned.Missing, planned.InventoryDate)
+	if written == 0 {
+		return ""
+	}
+	return fmt.Sprintf(
+		"%d objects written since the inventory of %s",
+		written,
+		planned.InventoryDate.UTC().Format(time.RFC3339),
+	)
+}
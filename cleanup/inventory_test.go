@@ -0,0 +1,336 @@
+package cleanup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func gzipBody(t *testing.T, data string) *s3.GetObjectOutput {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(&buffer)}
+}
+
+func textBody(data string) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewBufferString(data))}
+}
+
+func TestGetBucketListingFromInventory(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface, useInventory: true}
+	created := time.Now().Add(-day).Truncate(time.Millisecond)
+	prefix := "inventory/team-a-logs/daily/"
+
+	mockS3Iface.EXPECT().ListBucketInventoryConfigurationsWithContext(
+		gomock.Any(),
+		&s3.ListBucketInventoryConfigurationsInput{Bucket: bucket.Name},
+	).Return(
+		&s3.ListBucketInventoryConfigurationsOutput{
+			InventoryConfigurationList: []*s3.InventoryConfiguration{
+				&s3.InventoryConfiguration{
+					Id:        aws.String("disabled"),
+					IsEnabled: aws.Bool(false),
+				},
+				&s3.InventoryConfiguration{
+					Id:        aws.String("daily"),
+					IsEnabled: aws.Bool(true),
+					Destination: &s3.InventoryDestination{
+						S3BucketDestination: &s3.InventoryS3BucketDestination{
+							Bucket: aws.String("arn:aws:s3:::inventories"),
+							Format: aws.String(s3.InventoryFormatCsv),
+							Prefix: aws.String("inventory"),
+						},
+					},
+				},
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{
+			Bucket:    aws.String("inventories"),
+			Prefix:    aws.String(prefix),
+			Delimiter: aws.String("/"),
+		},
+	).Return(
+		&s3.ListObjectsOutput{
+			CommonPrefixes: []*s3.CommonPrefix{
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "2016-11-01T00-00Z/")},
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "2016-11-03T00-00Z/")},
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "data/")},
+				&s3.CommonPrefix{Prefix: aws.String(prefix + "2016-11-02T00-00Z/")},
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetObjectWithContext(
+		gomock.Any(),
+		&s3.GetObjectInput{
+			Bucket: aws.String("inventories"),
+			Key:    aws.String(prefix + "2016-11-03T00-00Z/manifest.json"),
+		},
+	).Return(nil, awserr.New(errCodeNoSuchKey, "still writing", nil))
+	mockS3Iface.EXPECT().GetObjectWithContext(
+		gomock.Any(),
+		&s3.GetObjectInput{
+			Bucket: aws.String("inventories"),
+			Key:    aws.String(prefix + "2016-11-02T00-00Z/manifest.json"),
+		},
+	).Return(
+		textBody(`{
+			"fileFormat": "CSV",
+			"fileSchema": "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate",
+			"creationTimestamp": "`+strconv.FormatInt(created.UnixNano()/int64(time.Millisecond), 10)+`",
+			"files": [{"key": "`+prefix+`data/1.csv.gz"}]
+		}`),
+		nil,
+	)
+	mockS3Iface.EXPECT().GetObjectWithContext(
+		gomock.Any(),
+		&s3.GetObjectInput{
+			Bucket: aws.String("inventories"),
+			Key:    aws.String(prefix + "data/1.csv.gz"),
+		},
+	).Return(
+		gzipBody(
+			t,
+			`"team-a-logs","dir/a+b.txt","v2","true","false","10","2016-11-01T10:00:00.000Z"`+"\n"+
+				`"team-a-logs","dir/a+b.txt","v1","false","false","8","2016-10-01T10:00:00.000Z"`+"\n"+
+				`"team-a-logs","old","","true","true","","2016-10-01T10:00:00.000Z"`+"\n",
+		),
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: bucket.Name},
+	).Return(
+		&s3.ListObjectsOutput{
+			Contents: []*s3.Object{
+				&s3.Object{
+					Key:          aws.String("dir/a b.txt"),
+					LastModified: aws.Time(created.Add(-time.Hour)),
+					Size:         aws.Int64(10),
+				},
+				&s3.Object{
+					Key:          aws.String("missed"),
+					LastModified: aws.Time(created.Add(-time.Hour)),
+					Size:         aws.Int64(5),
+				},
+			},
+		},
+		nil,
+	)
+
+	planned, err := csbc.getBucketListing(context.Background(), bucket)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !planned.InventoryDate.Equal(created) {
+		t.Errorf("Expected inventory date %v but got %v", created, planned.InventoryDate)
+	}
+	if len(planned.Objects) != 2 ||
+		*planned.Objects[0].Key != "dir/a b.txt" ||
+		len(planned.Missing) != 1 ||
+		*planned.Missing[0].Key != "missed" ||
+		planned.Size() != 15 {
+		t.Errorf("Expected the latest version of 'dir/a b.txt' and 'missed' but got %v", planned.Objects)
+	}
+	ids := planned.identifiers()
+	if len(ids) != 4 || *ids[2].VersionId != "null" || *ids[3].Key != "missed" {
+		t.Errorf("Expected every version, delete marker and missing object but got %v", ids)
+	}
+	if reason := inventoryReason(planned); reason != "" {
+		t.Errorf("Expected no reason for an object older than the inventory but got '%v'", reason)
+	}
+}
+
+func TestGetBucketListingWithoutInventory(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface, useInventory: true}
+	mockS3Iface.EXPECT().ListBucketInventoryConfigurationsWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.ListBucketInventoryConfigurationsOutput{},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: bucket.Name},
+	).Return(
+		&s3.ListObjectsOutput{
+			Contents: []*s3.Object{&s3.Object{Key: aws.String("a")}},
+		},
+		nil,
+	)
+
+	planned, err := csbc.getBucketListing(context.Background(), bucket)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(planned.Objects) != 1 || !planned.InventoryDate.IsZero() {
+		t.Errorf("Expected a listing but got %v", planned)
+	}
+}
+
+func TestDeleteActionDeletesObjectsMissingFromInventory(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	missed := &s3.Object{Key: aws.String("missed")}
+	planned := &PlannedBucket{
+		Bucket:        bucket,
+		Objects:       []*s3.Object{&s3.Object{Key: aws.String("old")}, missed},
+		Missing:       []*s3.Object{missed},
+		InventoryDate: time.Now().Add(-day),
+	}
+	gomock.InOrder(
+		mockS3Iface.EXPECT().DeleteObjectsWithContext(
+			gomock.Any(),
+			&s3.DeleteObjectsInput{
+				Bucket: bucket.Name,
+				Delete: &s3.Delete{
+					Objects: []*s3.ObjectIdentifier{
+						&s3.ObjectIdentifier{Key: aws.String("old")},
+						&s3.ObjectIdentifier{Key: aws.String("missed")},
+					},
+				},
+			},
+		).Return(&s3.DeleteObjectsOutput{}, nil),
+		mockS3Iface.EXPECT().DeleteBucketWithContext(
+			gomock.Any(),
+			&s3.DeleteBucketInput{Bucket: bucket.Name},
+		).Return(&s3.DeleteBucketOutput{}, nil),
+	)
+
+	result := (&deleteAction{}).Apply(
+		context.Background(),
+		&ActionTarget{PlannedBucket: planned, S3: mockS3Iface, c: csbc},
+	)
+	if result.Outcome != OutcomeDeleted {
+		t.Errorf("Expected '%v' but got %v", OutcomeDeleted, result)
+	}
+}
+
+func TestInventoryReason(t *testing.T) {
+	inventoryDate := time.Now().Add(-day)
+	var tests = []struct {
+		planned *PlannedBucket
+		skipped bool
+	}{
+		{
+			planned: &PlannedBucket{
+				Missing:       []*s3.Object{&s3.Object{LastModified: aws.Time(time.Now())}},
+				InventoryDate: inventoryDate,
+			},
+			skipped: true,
+		},
+		{
+			planned: &PlannedBucket{
+				Missing:       []*s3.Object{&s3.Object{LastModified: aws.Time(inventoryDate.Add(-time.Hour))}},
+				InventoryDate: inventoryDate,
+			},
+			skipped: false,
+		},
+		{
+			planned: &PlannedBucket{
+				Objects: []*s3.Object{&s3.Object{LastModified: aws.Time(time.Now())}},
+			},
+			skipped: false,
+		},
+	}
+	for _, test := range tests {
+		result := inventoryReason(test.planned) != ""
+		if result != test.skipped {
+			t.Errorf("Expected skipped '%v' but got '%v'", test.skipped, result)
+		}
+	}
+}
+
+func TestGetBucketListingWithOldInventory(t *testing.T) {
+	var tests = []struct {
+		minIdleAge time.Duration
+		age        time.Duration
+	}{
+		{minIdleAge: 12 * time.Hour, age: day},
+		{age: 8 * day},
+	}
+	for _, test := range tests {
+		_, mockS3Iface, ctrl := getMocks(t)
+
+		bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+		csbc := &Cleaner{s3SVC: mockS3Iface, useInventory: true, minIdleAge: test.minIdleAge}
+		created := time.Now().Add(-test.age)
+		prefix := "inventory/team-a-logs/daily/"
+		mockS3Iface.EXPECT().ListBucketInventoryConfigurationsWithContext(gomock.Any(), gomock.Any()).Return(
+			&s3.ListBucketInventoryConfigurationsOutput{
+				InventoryConfigurationList: []*s3.InventoryConfiguration{
+					&s3.InventoryConfiguration{
+						Id:        aws.String("daily"),
+						IsEnabled: aws.Bool(true),
+						Destination: &s3.InventoryDestination{
+							S3BucketDestination: &s3.InventoryS3BucketDestination{
+								Bucket: aws.String("arn:aws:s3:::inventories"),
+								Format: aws.String(s3.InventoryFormatCsv),
+								Prefix: aws.String("inventory"),
+							},
+						},
+					},
+				},
+			},
+			nil,
+		)
+		mockS3Iface.EXPECT().ListObjectsWithContext(
+			gomock.Any(),
+			&s3.ListObjectsInput{
+				Bucket:    aws.String("inventories"),
+				Prefix:    aws.String(prefix),
+				Delimiter: aws.String("/"),
+			},
+		).Return(
+			&s3.ListObjectsOutput{
+				CommonPrefixes: []*s3.CommonPrefix{
+					&s3.CommonPrefix{Prefix: aws.String(prefix + "2016-11-02T00-00Z/")},
+				},
+			},
+			nil,
+		)
+		mockS3Iface.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(
+			textBody(`{
+				"fileFormat": "CSV",
+				"creationTimestamp": "`+strconv.FormatInt(created.UnixNano()/int64(time.Millisecond), 10)+`"
+			}`),
+			nil,
+		)
+		mockS3Iface.EXPECT().ListObjectsWithContext(
+			gomock.Any(),
+			&s3.ListObjectsInput{Bucket: bucket.Name},
+		).Return(&s3.ListObjectsOutput{}, nil)
+
+		planned, err := csbc.getBucketListing(context.Background(), bucket)
+		if err != nil || !planned.InventoryDate.IsZero() {
+			t.Errorf("Expected a listing instead of the inventory but got %v and %v", planned, err)
+		}
+		ctrl.Finish()
+	}
+}
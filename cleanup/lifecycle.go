@@ -0,0 +1,262 @@
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	DefaultLifecycleBackupPrefix = "cleanup/lifecycle-backups"
+
+	expiringTag       = "cleanup:expiring"
+	expireLifecycleID = "CleanupExpire"
+	expireAfterDays   = 1
+
+	errCodeNoSuchLifecycleConfiguration = "NoSuchLifecycleConfiguration"
+)
+
+// lifecycleBackup is the lifecycle configuration a bucket had before the
+// lifecycle-expire action replaced it. Rules is empty when it had none.
+type lifecycleBackup struct {
+	Bucket string              `json:"bucket"`
+	Saved  time.Time           `json:"saved"`
+	Rules  []*s3.LifecycleRule `json:"rules"`
+}
+
+// lifecycleAction lets S3 expire the objects instead of deleting them one
+// request at a time. It tags the bucket as pending and deletes it on a
+// later run once it is observed empty.
+type lifecycleAction struct{}
+
+func (a *lifecycleAction) Name() string {
+	return ActionLifecycleExpire
+}
+
+func (a *lifecycleAction) Apply(
+	ctx context.Context,
+	target *ActionTarget,
+) *ActionResult {
+	c := target.c
+	bucket := target.Bucket
+	tags, err := c.getBucketTags(ctx, bucket)
+	if err != nil {
+		return &ActionResult{Err: err}
+	}
+	since := tagValue(tags, expiringTag)
+	if since == "" {
+		reason := fmt.Sprintf("objects expire after %d day", expireAfterDays)
+		if target.DryRun {
+			return &ActionResult{Outcome: OutcomeWouldExpire, Reason: reason}
+		}
+		if err := c.saveLifecycle(ctx, bucket); err != nil {
+			return &ActionResult{Err: err}
+		}
+		if err := c.expireBucket(ctx, bucket); err != nil {
+			return &ActionResult{Err: err}
+		}
+		if _, err := c.addBucketTag(ctx, bucket, expiringTag, timestamp()); err != nil {
+			return &ActionResult{Err: err}
+		}
+		target.Log("Expiring bucket: ", *bucket.Name)
+		return &ActionResult{Outcome: OutcomeExpiring, Reason: reason}
+	}
+	result := c.finishPendingBucket(ctx, target, "expiring since "+since)
+	if result.Outcome == OutcomeDeleted {
+		result.Err = c.removeLifecycleBackup(ctx, *bucket.Name)
+	}
+	return result
+}
+
+// getPendingListing returns the plan for a bucket an earlier run tagged
+// as expiring, or nil when it is not. Deciding whether it is empty only
+// takes its first object, so it is not listed in full on every run.
+func (c *Cleaner) getPendingListing(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (*PlannedBucket, error) {
+	if c.bucketAction().Name() != ActionLifecycleExpire {
+		return nil, nil
+	}
+	tags, err := c.getBucketTags(ctx, bucket)
+	if err != nil || tagValue(tags, expiringTag) == "" {
+		return nil, err
+	}
+	resp, err := c.s3SVC.ListObjectsV2WithContext(
+		ctx,
+		&s3.ListObjectsV2Input{
+			Bucket:  bucket.Name,
+			MaxKeys: aws.Int64(1),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &PlannedBucket{Bucket: bucket, Objects: resp.Contents, Pending: true}, nil
+}
+
+// expireBucket replaces the lifecycle configuration with one rule that
+// expires current and noncurrent versions and aborts multipart uploads.
+func (c *Cleaner) expireBucket(ctx context.Context, bucket *s3.Bucket) error {
+	_, err := c.s3SVC.PutBucketLifecycleConfigurationWithContext(
+		ctx,
+		&s3.PutBucketLifecycleConfigurationInput{
+			Bucket: bucket.Name,
+			LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
+				Rules: []*s3.LifecycleRule{
+					&s3.LifecycleRule{
+						ID:     aws.String(expireLifecycleID),
+						Prefix: aws.String(""),
+						Status: aws.String(s3.ExpirationStatusEnabled),
+						Expiration: &s3.LifecycleExpiration{
+							Days: aws.Int64(expireAfterDays),
+						},
+						NoncurrentVersionExpiration: &s3.NoncurrentVersionExpiration{
+							NoncurrentDays: aws.Int64(expireAfterDays),
+						},
+						AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
+							DaysAfterInitiation: aws.Int64(expireAfterDays),
+						},
+					},
+				},
+			},
+		},
+	)
+	return err
+}
+
+func (c *Cleaner) lifecycleBackupKey(name string) string {
+	return path.Join(c.lifecycleBackupPrefix, name+".json")
+}
+
+// backupBucketReason keeps the bucket the lifecycle backups are stored in.
+func (c *Cleaner) backupBucketReason(bucket *s3.Bucket) string {
+	if c.lifecycleBackupBucket != "" && *bucket.Name == c.lifecycleBackupBucket {
+		return "holds lifecycle backups"
+	}
+	return ""
+}
+
+// getLifecycleBackup reads the saved lifecycle configuration of the named
+// bucket. It returns nil when none was saved.
+func (c *Cleaner) getLifecycleBackup(
+	ctx context.Context,
+	name string,
+) (*lifecycleBackup, error) {
+	body, err := c.getObjectBody(ctx, c.lifecycleBackupBucket, c.lifecycleBackupKey(name))
+	if err != nil || body == nil {
+		return nil, err
+	}
+	defer body.Close()
+	backup := &lifecycleBackup{}
+	if err := json.NewDecoder(body).Decode(backup); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// saveLifecycle writes the bucket's lifecycle configuration to the backup
+// bucket. An existing backup is kept, as it holds the configuration from
+// before the first expiry.
+func (c *Cleaner) saveLifecycle(ctx context.Context, bucket *s3.Bucket) error {
+	if c.lifecycleBackupBucket == "" {
+		return fmt.Errorf("%s needs a lifecycle backup bucket", ActionLifecycleExpire)
+	}
+	existing, err := c.getLifecycleBackup(ctx, *bucket.Name)
+	if err != nil || existing != nil {
+		return err
+	}
+	backup := &lifecycleBackup{Bucket: *bucket.Name, Saved: time.Now().UTC()}
+	resp, err := c.s3SVC.GetBucketLifecycleConfigurationWithContext(
+		ctx,
+		&s3.GetBucketLifecycleConfigurationInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if !isAWSErrorCode(err, errCodeNoSuchLifecycleConfiguration) {
+		if err != nil {
+			return err
+		}
+		backup.Rules = resp.Rules
+	}
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = c.s3SVC.PutObjectWithContext(
+		ctx,
+		&s3.PutObjectInput{
+			Bucket:      aws.String(c.lifecycleBackupBucket),
+			Key:         aws.String(c.lifecycleBackupKey(*bucket.Name)),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("application/json"),
+		},
+	)
+	return err
+}
+
+func (c *Cleaner) removeLifecycleBackup(ctx context.Context, name string) error {
+	if c.lifecycleBackupBucket == "" {
+		return nil
+	}
+	_, err := c.s3SVC.DeleteObjectWithContext(
+		ctx,
+		&s3.DeleteObjectInput{
+			Bucket: aws.String(c.lifecycleBackupBucket),
+			Key:    aws.String(c.lifecycleBackupKey(name)),
+		},
+	)
+	return err
+}
+
+// RollbackLifecycle restores the lifecycle configuration the
+// lifecycle-expire action saved for the named bucket and clears its
+// pending tag. Objects that already expired are not restored.
+func (c *Cleaner) RollbackLifecycle(ctx context.Context, name string) error {
+	if c.lifecycleBackupBucket == "" {
+		return fmt.Errorf("no lifecycle backup bucket to restore %s from", name)
+	}
+	backup, err := c.getLifecycleBackup(ctx, name)
+	if err != nil {
+		return err
+	}
+	if backup == nil {
+		return fmt.Errorf("no saved lifecycle configuration for %s", name)
+	}
+	bucket := &s3.Bucket{Name: aws.String(name)}
+	if len(backup.Rules) == 0 {
+		_, err = c.s3SVC.DeleteBucketLifecycleWithContext(
+			ctx,
+			&s3.DeleteBucketLifecycleInput{
+				Bucket: bucket.Name,
+			},
+		)
+	} else {
+		_, err = c.s3SVC.PutBucketLifecycleConfigurationWithContext(
+			ctx,
+			&s3.PutBucketLifecycleConfigurationInput{
+				Bucket: bucket.Name,
+				LifecycleConfiguration: &s3.BucketLifecycleConfiguration{
+					Rules: backup.Rules,
+				},
+			},
+		)
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.removeBucketTag(ctx, bucket, expiringTag); err != nil {
+		return err
+	}
+	if err := c.removeLifecycleBackup(ctx, name); err != nil {
+		return err
+	}
+	c.log("Restored lifecycle configuration of bucket: ", name)
+	return nil
+}
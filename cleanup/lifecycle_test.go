@@ -0,0 +1,282 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/PermissionData/cloudformation_s3bucket_cleanup/mock_s3iface"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func getTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func getBackupCleaner(s3SVC *mock_s3iface.MockS3API) *Cleaner {
+	return &Cleaner{
+		s3SVC:                 s3SVC,
+		lifecycleBackupBucket: "backups",
+		lifecycleBackupPrefix: DefaultLifecycleBackupPrefix,
+	}
+}
+
+func expectNoLifecycleBackup(mockS3Iface *mock_s3iface.MockS3API) {
+	mockS3Iface.EXPECT().GetObjectWithContext(
+		gomock.Any(),
+		&s3.GetObjectInput{
+			Bucket: aws.String("backups"),
+			Key:    aws.String("cleanup/lifecycle-backups/team-a-logs.json"),
+		},
+	).Return(nil, awserr.New(errCodeNoSuchKey, "none", nil))
+}
+
+func TestLifecycleActionExpires(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := getBackupCleaner(mockS3Iface)
+	original := []*s3.LifecycleRule{
+		&s3.LifecycleRule{ID: aws.String("logs"), Prefix: aws.String("logs/")},
+	}
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(&s3.GetBucketTaggingOutput{TagSet: []*s3.Tag{}}, nil).Times(2)
+	expectNoLifecycleBackup(mockS3Iface)
+	mockS3Iface.EXPECT().GetBucketLifecycleConfigurationWithContext(
+		gomock.Any(),
+		&s3.GetBucketLifecycleConfigurationInput{Bucket: bucket.Name},
+	).Return(&s3.GetBucketLifecycleConfigurationOutput{Rules: original}, nil)
+	mockS3Iface.EXPECT().PutObjectWithContext(gomock.Any(), gomock.Any()).Do(
+		func(_ aws.Context, input *s3.PutObjectInput, _ ...request.Option) {
+			backup := &lifecycleBackup{}
+			if err := json.NewDecoder(input.Body).Decode(backup); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if aws.StringValue(input.Bucket) != "backups" ||
+				aws.StringValue(input.Key) != "cleanup/lifecycle-backups/team-a-logs.json" ||
+				len(backup.Rules) != 1 {
+				t.Errorf("Expected a backup of %v but got %v", original, backup)
+			}
+		},
+	).Return(&s3.PutObjectOutput{}, nil)
+	mockS3Iface.EXPECT().PutBucketLifecycleConfigurationWithContext(gomock.Any(), gomock.Any()).Do(
+		func(_ aws.Context, input *s3.PutBucketLifecycleConfigurationInput, _ ...request.Option) {
+			rules := input.LifecycleConfiguration.Rules
+			if len(rules) != 1 ||
+				rules[0].NoncurrentVersionExpiration == nil ||
+				rules[0].AbortIncompleteMultipartUpload == nil {
+				t.Errorf("Expected the %v rule but got %v", expireLifecycleID, rules)
+			}
+		},
+	).Return(&s3.PutBucketLifecycleConfigurationOutput{}, nil)
+	mockS3Iface.EXPECT().PutBucketTaggingWithContext(gomock.Any(), gomock.Any()).Do(
+		func(_ aws.Context, input *s3.PutBucketTaggingInput, _ ...request.Option) {
+			if !hasTag(input.Tagging.TagSet, expiringTag, "") {
+				t.Errorf("Expected the %v tag but got %v", expiringTag, input.Tagging.TagSet)
+			}
+		},
+	).Return(&s3.PutBucketTaggingOutput{}, nil)
+
+	result := (&lifecycleAction{}).Apply(
+		context.Background(),
+		&ActionTarget{
+			PlannedBucket: &PlannedBucket{Bucket: bucket},
+			S3:            mockS3Iface,
+			c:             csbc,
+		},
+	)
+	if result.Outcome != OutcomeExpiring {
+		t.Errorf("Expected '%v' but got %v", OutcomeExpiring, result)
+	}
+}
+
+func TestSaveLifecycleKeepsExistingBackup(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	mockS3Iface.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetObjectOutput{
+			Body: ioutil.NopCloser(strings.NewReader(`{"bucket":"team-a-logs","rules":[]}`)),
+		},
+		nil,
+	)
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	if err := getBackupCleaner(mockS3Iface).saveLifecycle(context.Background(), bucket); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := (&Cleaner{}).saveLifecycle(context.Background(), bucket); err == nil {
+		t.Errorf("Expected an error without a backup bucket")
+	}
+}
+
+func TestLifecycleActionPendingBucket(t *testing.T) {
+	var tests = []struct {
+		objects  []*s3.Object
+		versions []*s3.ObjectVersion
+		dryRun   bool
+		expected string
+	}{
+		{
+			objects:  []*s3.Object{&s3.Object{Key: aws.String("a")}},
+			expected: OutcomePending,
+		},
+		{
+			versions: []*s3.ObjectVersion{&s3.ObjectVersion{Key: aws.String("a")}},
+			expected: OutcomePending,
+		},
+		{dryRun: true, expected: OutcomeWouldDelete},
+		{expected: OutcomeDeleted},
+	}
+	for _, test := range tests {
+		_, mockS3Iface, ctrl := getMocks(t)
+
+		bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+		csbc := getBackupCleaner(mockS3Iface)
+		mockS3Iface.EXPECT().GetBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+			&s3.GetBucketTaggingOutput{
+				TagSet: []*s3.Tag{
+					&s3.Tag{
+						Key:   aws.String(expiringTag),
+						Value: aws.String("2016-01-01T00:00:00Z"),
+					},
+				},
+			},
+			nil,
+		)
+		if len(test.objects) == 0 {
+			mockS3Iface.EXPECT().ListObjectVersionsWithContext(gomock.Any(), gomock.Any()).Return(
+				&s3.ListObjectVersionsOutput{Versions: test.versions},
+				nil,
+			)
+		}
+		if test.expected == OutcomeDeleted {
+			mockS3Iface.EXPECT().DeleteBucketWithContext(
+				gomock.Any(),
+				&s3.DeleteBucketInput{Bucket: bucket.Name},
+			).Return(&s3.DeleteBucketOutput{}, nil)
+			mockS3Iface.EXPECT().DeleteObjectWithContext(
+				gomock.Any(),
+				&s3.DeleteObjectInput{
+					Bucket: aws.String("backups"),
+					Key:    aws.String("cleanup/lifecycle-backups/team-a-logs.json"),
+				},
+			).Return(&s3.DeleteObjectOutput{}, nil)
+		}
+
+		result := (&lifecycleAction{}).Apply(
+			context.Background(),
+			&ActionTarget{
+				PlannedBucket: &PlannedBucket{Bucket: bucket, Objects: test.objects},
+				S3:            mockS3Iface,
+				DryRun:        test.dryRun,
+				c:             csbc,
+			},
+		)
+		if result.Outcome != test.expected {
+			t.Errorf("Expected '%v' but got %v", test.expected, result)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestGetPendingListing(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	if planned, err := (&Cleaner{s3SVC: mockS3Iface}).getPendingListing(ctx, bucket); err != nil || planned != nil {
+		t.Errorf("Expected no pending listing for the delete action but got %v, %v", planned, err)
+	}
+
+	csbc := &Cleaner{s3SVC: mockS3Iface, action: &lifecycleAction{}}
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketTaggingOutput{},
+		nil,
+	)
+	if planned, err := csbc.getPendingListing(ctx, bucket); err != nil || planned != nil {
+		t.Errorf("Expected no pending listing for an untagged bucket but got %v, %v", planned, err)
+	}
+
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketTaggingOutput{
+			TagSet: []*s3.Tag{
+				&s3.Tag{Key: aws.String(expiringTag), Value: aws.String("2016-01-01T00:00:00Z")},
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsV2WithContext(
+		gomock.Any(),
+		&s3.ListObjectsV2Input{Bucket: bucket.Name, MaxKeys: aws.Int64(1)},
+	).Return(
+		&s3.ListObjectsV2Output{
+			Contents: []*s3.Object{&s3.Object{Key: aws.String("testkey1")}},
+		},
+		nil,
+	)
+	planned, err := csbc.getPendingListing(ctx, bucket)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if planned == nil || !planned.Pending || len(planned.Objects) != 1 {
+		t.Errorf("Expected a pending bucket with one object but got %+v", planned)
+	}
+}
+
+func TestRollbackLifecycle(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := getBackupCleaner(mockS3Iface)
+	expectNoLifecycleBackup(mockS3Iface)
+	if err := csbc.RollbackLifecycle(context.Background(), "team-a-logs"); err == nil {
+		t.Errorf("Expected an error without a backup")
+	}
+
+	mockS3Iface.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetObjectOutput{
+			Body: ioutil.NopCloser(strings.NewReader(`{"bucket":"team-a-logs","rules":[]}`)),
+		},
+		nil,
+	)
+
+	mockS3Iface.EXPECT().DeleteBucketLifecycleWithContext(
+		gomock.Any(),
+		&s3.DeleteBucketLifecycleInput{Bucket: bucket.Name},
+	).Return(&s3.DeleteBucketLifecycleOutput{}, nil)
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketTaggingOutput{
+			TagSet: []*s3.Tag{
+				&s3.Tag{Key: aws.String(expiringTag), Value: aws.String("x")},
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().DeleteBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.DeleteBucketTaggingInput{Bucket: bucket.Name},
+	).Return(&s3.DeleteBucketTaggingOutput{}, nil)
+	mockS3Iface.EXPECT().DeleteObjectWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.DeleteObjectOutput{},
+		nil,
+	)
+
+	if err := csbc.RollbackLifecycle(context.Background(), "team-a-logs"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package cleanup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// runLimits caps how much a single run may delete. A zero limit is
+// unlimited.
+type runLimits struct {
+	maxBuckets int
+	maxObjects int64
+	maxBytes   int64
+	force      bool
+}
+
+// PlannedBucket is a bucket a plan will act on, with the objects the
+// action covers: every object for a deletion, the stale ones for a prune.
+type PlannedBucket struct {
+	Bucket  *s3.Bucket
+	Objects []*s3.Object
+	// Versions are every object version and delete marker, when the
+	// objects were read from an inventory that includes them or the bucket
+	// has Object Lock.
+	Versions []*s3.ObjectIdentifier
+	// InventoryDate is when the inventory the objects were read from was
+	// taken, zero when they were listed.
+	InventoryDate time.Time
+	// Missing are the objects a listing found that the inventory does not
+	// include, or that changed since. They are part of Objects as well.
+	Missing []*s3.Object
+	// BypassGovernance deletes objects under Object Lock governance
+	// retention.
+	BypassGovernance bool
+	// Dependents are what relies on the bucket, see
+	// Options.AllowDependents.
+	Dependents []string
+	// Pending is set for a bucket an earlier lifecycle-expire run left for
+	// S3 to empty. Objects then holds at most one object, and the bucket is
+	// left out of the run limits.
+	Pending bool
+}
+
+// identifiers returns what has to be deleted to empty the bucket.
+func (p *PlannedBucket) identifiers() []*s3.ObjectIdentifier {
+	if len(p.Versions) > 0 {
+		ids := append([]*s3.ObjectIdentifier{}, p.Versions...)
+		return append(ids, getObjectIDStruct(p.Missing)...)
+	}
+	return getObjectIDStruct(p.Objects)
+}
+
+// Size returns the total size of the planned objects in bytes.
+func (p *PlannedBucket) Size() int64 {
+	var total int64
+	for _, object := range p.Objects {
+		total += aws.Int64Value(object.Size)
+	}
+	return total
+}
+
+func planTotals(plan []*PlannedBucket) (int64, int64) {
+	var objects, bytes int64
+	for _, planned := range plan {
+		objects += int64(len(planned.Objects))
+		bytes += planned.Size()
+	}
+	return objects, bytes
+}
+
+// LimitError is returned when a plan exceeds one of the run limits and
+// Options.Force is not set.
+type LimitError struct {
+	// What is counted: buckets, objects or bytes.
+	What  string
+	Count int64
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("refusing to delete %d %s, the limit is %d", e.Count, e.What, e.Limit)
+}
+
+// checkLimits returns an error describing the first limit the plan
+// exceeds. It is evaluated before any bucket is touched.
+func (c *Cleaner) checkLimits(plan []*PlannedBucket) error {
+	if c.limits.force {
+		return nil
+	}
+	plan = limitedBuckets(plan)
+	objects, bytes := planTotals(plan)
+	switch {
+	case c.limits.maxBuckets > 0 && len(plan) > c.limits.maxBuckets:
+		return &LimitError{"buckets", int64(len(plan)), int64(c.limits.maxBuckets)}
+	case c.limits.maxObjects > 0 && objects > c.limits.maxObjects:
+		return &LimitError{"objects", objects, c.limits.maxObjects}
+	case c.limits.maxBytes > 0 && bytes > c.limits.maxBytes:
+		return &LimitError{"bytes", bytes, c.limits.maxBytes}
+	}
+	return nil
+}
+
+// removesData reports whether the named action deletes objects. Only
+// report, tag and quarantine leave the data in place; an action a library
+// user supplies is held to the limits as well.
+func removesData(action string) bool {
+	switch action {
+	case ActionReport, ActionTag, ActionQuarantine:
+		return false
+	}
+	return true
+}
+
+// limitedBuckets leaves out the pending buckets, which S3 is already
+// emptying.
+func limitedBuckets(plan []*PlannedBucket) []*PlannedBucket {
+	limited := []*PlannedBucket{}
+	for _, planned := range plan {
+		if !planned.Pending {
+			limited = append(limited, planned)
+		}
+	}
+	return limited
+}
+
+// enforceLimits refuses a plan that exceeds a limit. A dry run only logs
+// the violation so the full plan can still be reviewed.
+func (c *Cleaner) enforceLimits(plan []*PlannedBucket) error {
+	err := c.checkLimits(plan)
+	if err != nil && c.dryRun {
+		c.log("Dry run: ", err.Error())
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package cleanup
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestCheckLimits(t *testing.T) {
+	plan := []*PlannedBucket{
+		&PlannedBucket{
+			Bucket: &s3.Bucket{Name: aws.String("testbucket1")},
+			Objects: []*s3.Object{
+				&s3.Object{Key: aws.String("testkey1"), Size: aws.Int64(100)},
+				&s3.Object{Key: aws.String("testkey2"), Size: aws.Int64(200)},
+			},
+		},
+		&PlannedBucket{
+			Bucket:  &s3.Bucket{Name: aws.String("testbucket2")},
+			Objects: []*s3.Object{},
+		},
+	}
+
+	var happyPathTests = []runLimits{
+		runLimits{},
+		runLimits{maxBuckets: 2, maxObjects: 2, maxBytes: 300},
+		runLimits{maxBuckets: 1, maxObjects: 1, maxBytes: 1, force: true},
+	}
+	for _, limits := range happyPathTests {
+		csbc := &Cleaner{limits: limits}
+		if err := csbc.checkLimits(plan); err != nil {
+			t.Errorf("Expected no error for %+v but got %v", limits, err)
+		}
+	}
+
+	var negativeTests = []runLimits{
+		runLimits{maxBuckets: 1},
+		runLimits{maxObjects: 1},
+		runLimits{maxBytes: 299},
+	}
+	for _, limits := range negativeTests {
+		csbc := &Cleaner{limits: limits}
+		if _, ok := csbc.checkLimits(plan).(*LimitError); !ok {
+			t.Errorf("Expected a limit error for %+v", limits)
+		}
+	}
+}
+
+func TestCheckCombinedLimits(t *testing.T) {
+	bucket := func(name string) *PlannedBucket {
+		return &PlannedBucket{Bucket: &s3.Bucket{Name: aws.String(name)}}
+	}
+	plans := []*Plan{
+		&Plan{Buckets: []*PlannedBucket{bucket("team-a-logs")}},
+		&Plan{Buckets: []*PlannedBucket{bucket("team-b-logs")}},
+	}
+	csbc := &Cleaner{limits: runLimits{maxBuckets: 1}}
+	if err := csbc.checkLimits(plans[0].Buckets); err != nil {
+		t.Errorf("Expected one plan to be within the limits but got %v", err)
+	}
+	if _, ok := csbc.CheckLimits(plans).(*LimitError); !ok {
+		t.Errorf("Expected the plans together to exceed the limits")
+	}
+	plans[1].Action = ActionTag
+	if err := csbc.CheckLimits(plans); err != nil {
+		t.Errorf("Expected a tag plan to be left out of the limits but got %v", err)
+	}
+	plans[1].Action = ActionDelete
+	plans[1].Buckets[0].Pending = true
+	if err := csbc.CheckLimits(plans); err != nil {
+		t.Errorf("Expected a pending bucket to be left out of the limits but got %v", err)
+	}
+	plans[1].Buckets[0].Pending = false
+	csbc.dryRun = true
+	csbc.logger = &testLogger{}
+	if err := csbc.CheckLimits(plans); err != nil {
+		t.Errorf("Expected a dry run to only log %v", err)
+	}
+}
+
+func TestRemovesData(t *testing.T) {
+	var tests = []struct {
+		plan    Plan
+		removes bool
+	}{
+		{plan: Plan{Action: ActionReport}, removes: false},
+		{plan: Plan{Action: ActionTag}, removes: false},
+		{plan: Plan{Action: ActionQuarantine}, removes: false},
+		{plan: Plan{Action: ActionReport, Prune: true}, removes: true},
+		{plan: Plan{Action: ActionDelete}, removes: true},
+		{plan: Plan{Action: ActionArchiveThenDelete}, removes: true},
+		{plan: Plan{Action: ActionLifecycleExpire}, removes: true},
+		{plan: Plan{Action: ActionBatchManifest}, removes: true},
+		{plan: Plan{Action: "custom"}, removes: true},
+	}
+	for _, test := range tests {
+		if removes := test.plan.RemovesData(); removes != test.removes {
+			t.Errorf("Expected '%v' for %+v but got '%v'", test.removes, test.plan, removes)
+		}
+	}
+}
+
+func TestPlanTotals(t *testing.T) {
+	plan := []*PlannedBucket{
+		&PlannedBucket{
+			Objects: []*s3.Object{
+				&s3.Object{Size: aws.Int64(10)},
+				&s3.Object{},
+			},
+		},
+		&PlannedBucket{
+			Objects: []*s3.Object{&s3.Object{Size: aws.Int64(5)}},
+		},
+	}
+	objects, bytes := planTotals(plan)
+	if objects != 3 || bytes != 15 {
+		t.Errorf("Expected 3 objects and 15 bytes but got %v and %v", objects, bytes)
+	}
+}
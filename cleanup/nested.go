@@ -0,0 +1,97 @@
+package cleanup
+
+import (
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// discoveredStackStatuses are the states listed during discovery: every
+// state but DELETE_COMPLETE. A stack that is still being created, updated,
+// rolled back or deleted keeps its resources, so a root stack in any of
+// them is live, and so are its nested stacks.
+var discoveredStackStatuses = liveStackStatuses()
+
+func liveStackStatuses() []string {
+	var statuses []string
+	for _, status := range cloudformation.StackStatus_Values() {
+		if status != cloudformation.StackStatusDeleteComplete {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+var stackSetInstancePattern = regexp.MustCompile(
+	`^StackSet-(.+)-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`,
+)
+
+// stackSetName returns the stack set a StackSet-<name>-<uuid> stack
+// instance belongs to.
+func stackSetName(stackName string) (string, bool) {
+	match := stackSetInstancePattern.FindStringSubmatch(stackName)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+func isNestedStack(stack *cloudformation.StackSummary) bool {
+	return stack.RootId != nil &&
+		aws.StringValue(stack.RootId) != aws.StringValue(stack.StackId)
+}
+
+func stacksByID(
+	stacks []*cloudformation.StackSummary,
+) map[string]*cloudformation.StackSummary {
+	result := map[string]*cloudformation.StackSummary{}
+	for _, stack := range stacks {
+		result[aws.StringValue(stack.StackId)] = stack
+	}
+	return result
+}
+
+func isLiveStatus(stack *cloudformation.StackSummary) bool {
+	return contains(discoveredStackStatuses, aws.StringValue(stack.StackStatus))
+}
+
+func liveStacks(
+	stacks []*cloudformation.StackSummary,
+) []*cloudformation.StackSummary {
+	var (
+		live = []*cloudformation.StackSummary{}
+		byID = stacksByID(stacks)
+	)
+	for _, stack := range stacks {
+		if isNestedStack(stack) {
+			root, ok := byID[*stack.RootId]
+			if ok && !isNestedStack(root) && isLiveStatus(root) {
+				live = append(live, stack)
+			}
+			continue
+		}
+		if isLiveStatus(stack) {
+			live = append(live, stack)
+		}
+	}
+	return live
+}
+
+// describeStack names a stack the way the report shows it: nested stacks
+// under their root stack and stack set instances under their stack set.
+func (c *Cleaner) describeStack(
+	stack *cloudformation.StackSummary,
+) string {
+	name := aws.StringValue(stack.StackName)
+	if isNestedStack(stack) {
+		if root, ok := stacksByID(c.stacks)[*stack.RootId]; ok {
+			return "root stack " + aws.StringValue(root.StackName) +
+				" (nested stack " + name + ")"
+		}
+	}
+	if setName, ok := stackSetName(name); ok {
+		return "stack set " + setName + " (instance " + name + ")"
+	}
+	return "stack " + name
+}
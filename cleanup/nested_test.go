@@ -0,0 +1,153 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestStackSetName(t *testing.T) {
+	var tests = []struct {
+		stackName string
+		setName   string
+		ok        bool
+	}{
+		{
+			stackName: "StackSet-logging-baseline-0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d",
+			setName:   "logging-baseline",
+			ok:        true,
+		},
+		{stackName: "StackSet-logging", ok: false},
+		{stackName: "Parent-Child-XYZ123", ok: false},
+	}
+	for _, test := range tests {
+		setName, ok := stackSetName(test.stackName)
+		if setName != test.setName || ok != test.ok {
+			t.Errorf(
+				"Expected '%v', '%v' but got '%v', '%v'",
+				test.setName,
+				test.ok,
+				setName,
+				ok,
+			)
+		}
+	}
+}
+
+func TestLiveStacks(t *testing.T) {
+	stacks := []*cloudformation.StackSummary{
+		&cloudformation.StackSummary{
+			StackId:     aws.String("root1"),
+			StackName:   aws.String("Parent"),
+			StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+		},
+		&cloudformation.StackSummary{
+			StackId:     aws.String("nested1"),
+			StackName:   aws.String("Parent-Child-XYZ123"),
+			StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+			ParentId:    aws.String("root1"),
+			RootId:      aws.String("root1"),
+		},
+		&cloudformation.StackSummary{
+			StackId:     aws.String("root2"),
+			StackName:   aws.String("Updated"),
+			StackStatus: aws.String(cloudformation.StackStatusUpdateComplete),
+		},
+		&cloudformation.StackSummary{
+			StackId:     aws.String("nested2"),
+			StackName:   aws.String("Updated-Child-ABC987"),
+			StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+			ParentId:    aws.String("root2"),
+			RootId:      aws.String("root2"),
+		},
+		&cloudformation.StackSummary{
+			StackId:     aws.String("root4"),
+			StackName:   aws.String("Failed"),
+			StackStatus: aws.String(cloudformation.StackStatusRollbackComplete),
+		},
+		&cloudformation.StackSummary{
+			StackId:     aws.String("root5"),
+			StackName:   aws.String("Updating"),
+			StackStatus: aws.String(cloudformation.StackStatusUpdateInProgress),
+		},
+		&cloudformation.StackSummary{
+			StackId:     aws.String("root3"),
+			StackName:   aws.String("Deleted"),
+			StackStatus: aws.String(cloudformation.StackStatusDeleteComplete),
+		},
+		&cloudformation.StackSummary{
+			StackId:     aws.String("nested3"),
+			StackName:   aws.String("Deleted-Child-DEF456"),
+			StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+			ParentId:    aws.String("root3"),
+			RootId:      aws.String("root3"),
+		},
+	}
+	live := liveStacks(stacks)
+	if len(live) != 6 {
+		t.Fatalf("Expected every stack but Deleted and its nested stack to be live but got %v", live)
+	}
+	for i, stack := range live {
+		if stack != stacks[i] {
+			t.Errorf("Expected %v to be live but got %v", *stacks[i].StackName, *stack.StackName)
+		}
+	}
+}
+
+func TestDescribeStackAndNestedOwnership(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	csbc := &Cleaner{
+		s3SVC: mockS3Iface,
+		stacks: []*cloudformation.StackSummary{
+			&cloudformation.StackSummary{
+				StackId:      aws.String("root1"),
+				StackName:    aws.String("Parent"),
+				CreationTime: getTimeSecondsBeforeNow(5000),
+			},
+			&cloudformation.StackSummary{
+				StackId:      aws.String("nested1"),
+				StackName:    aws.String("Parent-Child-XYZ123"),
+				CreationTime: getTimeSecondsBeforeNow(4900),
+				RootId:       aws.String("root1"),
+			},
+			&cloudformation.StackSummary{
+				StackId:      aws.String("set1"),
+				StackName:    aws.String("StackSet-logs-0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d"),
+				CreationTime: getTimeSecondsBeforeNow(3000),
+			},
+		},
+	}
+	bucket := &s3.Bucket{
+		Name:         aws.String("parent-child-xyz123-artifacts-1a2b3c"),
+		CreationDate: getTimeSecondsBeforeNow(4890),
+	}
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(&s3.GetBucketTaggingOutput{}, nil)
+	score, err := csbc.scoreOwnership(context.Background(), bucket)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	owner := score.owner
+	if owner != csbc.stacks[1] {
+		t.Errorf("Expected the nested stack to own the bucket but got %v", owner)
+	}
+	if result := csbc.describeStack(owner); result !=
+		"root stack Parent (nested stack Parent-Child-XYZ123)" {
+		t.Errorf("Unexpected description %v", result)
+	}
+	if result := csbc.describeStack(csbc.stacks[2]); result !=
+		"stack set logs (instance StackSet-logs-0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d)" {
+		t.Errorf("Unexpected description %v", result)
+	}
+	if result := csbc.describeStack(csbc.stacks[0]); result != "stack Parent" {
+		t.Errorf("Unexpected description %v", result)
+	}
+}
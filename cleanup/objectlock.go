@@ -0,0 +1,197 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	errCodeObjectLockConfigurationNotFound = "ObjectLockConfigurationNotFoundError"
+	errCodeNoSuchObjectLockConfiguration   = "NoSuchObjectLockConfiguration"
+)
+
+// objectLocks tallies the versions Object Lock keeps from being deleted.
+type objectLocks struct {
+	legalHolds int
+	compliance int
+	governance int
+	// earliest is the first retain-until date among the retained
+	// versions.
+	earliest time.Time
+	// partial is set when the walk stopped at the first hard lock, so
+	// earliest only covers the versions checked before it.
+	partial bool
+}
+
+func (l *objectLocks) retain(until time.Time) {
+	if l.earliest.IsZero() || until.Before(l.earliest) {
+		l.earliest = until
+	}
+}
+
+func (l *objectLocks) String() string {
+	var parts []string
+	if l.legalHolds > 0 {
+		parts = append(parts, fmt.Sprintf("%d under legal hold", l.legalHolds))
+	}
+	if l.compliance > 0 {
+		parts = append(parts, fmt.Sprintf("%d in compliance mode", l.compliance))
+	}
+	if l.governance > 0 {
+		parts = append(parts, fmt.Sprintf("%d in governance mode", l.governance))
+	}
+	description := "object lock: " + strings.Join(parts, ", ")
+	if !l.earliest.IsZero() {
+		until := l.earliest.UTC().Format(time.RFC3339)
+		if l.partial {
+			description += ", a checked version retained until " + until
+		} else {
+			description += ", retained until " + until + " at the earliest"
+		}
+	}
+	return description
+}
+
+func (c *Cleaner) hasObjectLock(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (bool, error) {
+	resp, err := c.s3SVC.GetObjectLockConfigurationWithContext(
+		ctx,
+		&s3.GetObjectLockConfigurationInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if isAWSErrorCode(err, errCodeObjectLockConfigurationNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return resp.ObjectLockConfiguration != nil &&
+		aws.StringValue(resp.ObjectLockConfiguration.ObjectLockEnabled) ==
+			s3.ObjectLockEnabledEnabled, nil
+}
+
+// checkObjectLock adds the retention and legal hold of one version to
+// locks.
+func (c *Cleaner) checkObjectLock(
+	ctx context.Context,
+	locks *objectLocks,
+	bucket *s3.Bucket,
+	id *s3.ObjectIdentifier,
+) error {
+	hold, err := c.s3SVC.GetObjectLegalHoldWithContext(
+		ctx,
+		&s3.GetObjectLegalHoldInput{
+			Bucket:    bucket.Name,
+			Key:       id.Key,
+			VersionId: id.VersionId,
+		},
+	)
+	if !isAWSErrorCode(err, errCodeNoSuchObjectLockConfiguration) {
+		if err != nil {
+			return err
+		}
+		if hold.LegalHold != nil &&
+			aws.StringValue(hold.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn {
+			locks.legalHolds++
+		}
+	}
+	retention, err := c.s3SVC.GetObjectRetentionWithContext(
+		ctx,
+		&s3.GetObjectRetentionInput{
+			Bucket:    bucket.Name,
+			Key:       id.Key,
+			VersionId: id.VersionId,
+		},
+	)
+	if isAWSErrorCode(err, errCodeNoSuchObjectLockConfiguration) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if retention.Retention == nil ||
+		!aws.TimeValue(retention.Retention.RetainUntilDate).After(time.Now()) {
+		return nil
+	}
+	switch aws.StringValue(retention.Retention.Mode) {
+	case s3.ObjectLockRetentionModeCompliance:
+		locks.compliance++
+	case s3.ObjectLockRetentionModeGovernance:
+		locks.governance++
+	default:
+		return nil
+	}
+	locks.retain(*retention.Retention.RetainUntilDate)
+	return nil
+}
+
+// objectLockReason reports why Object Lock keeps the planned bucket from
+// being emptied. It walks every object version, since a noncurrent version
+// is locked as much as a current one, and stops at the first version under
+// legal hold or compliance retention. Governance retention alone is
+// bypassed with Options.BypassGovernanceRetention, which the planned bucket
+// then records. A completed walk also leaves every version and delete
+// marker in the planned bucket, as a bucket with Object Lock is versioned
+// and is only emptied by deleting them.
+func (c *Cleaner) objectLockReason(
+	ctx context.Context,
+	planned *PlannedBucket,
+) (string, error) {
+	locked, err := c.hasObjectLock(ctx, planned.Bucket)
+	if err != nil || !locked {
+		return "", err
+	}
+	locks := &objectLocks{}
+	var versions []*s3.ObjectIdentifier
+	input := &s3.ListObjectVersionsInput{Bucket: planned.Bucket.Name}
+	for {
+		resp, err := c.s3SVC.ListObjectVersionsWithContext(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		for _, version := range resp.Versions {
+			id := &s3.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId}
+			if err := c.checkObjectLock(ctx, locks, planned.Bucket, id); err != nil {
+				return "", err
+			}
+			if locks.legalHolds > 0 || locks.compliance > 0 {
+				locks.partial = true
+				return locks.String(), nil
+			}
+			versions = append(versions, id)
+		}
+		for _, marker := range resp.DeleteMarkers {
+			versions = append(
+				versions,
+				&s3.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId},
+			)
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			break
+		}
+		input.KeyMarker = resp.NextKeyMarker
+		input.VersionIdMarker = resp.NextVersionIdMarker
+	}
+	if len(versions) > 0 {
+		// The walk lists the versions of every object, including those an
+		// inventory missed, which deleting by key alone would only hide.
+		planned.Versions = versions
+		planned.Missing = nil
+	}
+	if locks.governance == 0 {
+		return "", nil
+	}
+	if c.bypassGovernance {
+		planned.BypassGovernance = true
+		return "", nil
+	}
+	return locks.String(), nil
+}
@@ -0,0 +1,300 @@
+package cleanup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestObjectLockReason(t *testing.T) {
+	future := time.Now().Add(30 * day)
+	past := time.Now().Add(-day)
+	var tests = []struct {
+		locked   bool
+		hold     string
+		mode     string
+		until    time.Time
+		bypass   bool
+		expected string
+	}{
+		{locked: false, expected: ""},
+		{locked: true, expected: ""},
+		{locked: true, hold: "ON", expected: "1 under legal hold"},
+		{locked: true, hold: "OFF", mode: "COMPLIANCE", until: future, expected: "1 in compliance mode, a checked version retained until"},
+		{locked: true, mode: "COMPLIANCE", until: past, expected: ""},
+		{
+			locked:   true,
+			mode:     "GOVERNANCE",
+			until:    future,
+			expected: "1 in governance mode, retained until " + future.UTC().Format(time.RFC3339) + " at the earliest",
+		},
+		{locked: true, mode: "GOVERNANCE", until: future, bypass: true, expected: ""},
+		{locked: true, hold: "ON", mode: "GOVERNANCE", until: future, bypass: true, expected: "1 under legal hold"},
+	}
+	for _, test := range tests {
+		_, mockS3Iface, ctrl := getMocks(t)
+
+		bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+		csbc := &Cleaner{
+			s3SVC:            mockS3Iface,
+			bypassGovernance: test.bypass,
+		}
+		planned := &PlannedBucket{
+			Bucket:  bucket,
+			Objects: []*s3.Object{&s3.Object{Key: aws.String("a")}},
+		}
+		if !test.locked {
+			mockS3Iface.EXPECT().GetObjectLockConfigurationWithContext(gomock.Any(), gomock.Any()).Return(
+				nil,
+				awserr.New(errCodeObjectLockConfigurationNotFound, "none", nil),
+			)
+		} else {
+			mockS3Iface.EXPECT().GetObjectLockConfigurationWithContext(gomock.Any(), gomock.Any()).Return(
+				&s3.GetObjectLockConfigurationOutput{
+					ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+						ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+					},
+				},
+				nil,
+			)
+			mockS3Iface.EXPECT().ListObjectVersionsWithContext(
+				gomock.Any(),
+				&s3.ListObjectVersionsInput{Bucket: bucket.Name},
+			).Return(
+				&s3.ListObjectVersionsOutput{
+					Versions: []*s3.ObjectVersion{
+						&s3.ObjectVersion{Key: aws.String("a"), VersionId: aws.String("v1")},
+					},
+				},
+				nil,
+			)
+			if test.hold == "" {
+				mockS3Iface.EXPECT().GetObjectLegalHoldWithContext(gomock.Any(), gomock.Any()).Return(
+					nil,
+					awserr.New(errCodeNoSuchObjectLockConfiguration, "none", nil),
+				)
+			} else {
+				mockS3Iface.EXPECT().GetObjectLegalHoldWithContext(
+					gomock.Any(),
+					&s3.GetObjectLegalHoldInput{
+						Bucket:    bucket.Name,
+						Key:       aws.String("a"),
+						VersionId: aws.String("v1"),
+					},
+				).Return(
+					&s3.GetObjectLegalHoldOutput{
+						LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(test.hold)},
+					},
+					nil,
+				)
+			}
+			if test.mode == "" {
+				mockS3Iface.EXPECT().GetObjectRetentionWithContext(gomock.Any(), gomock.Any()).Return(
+					nil,
+					awserr.New(errCodeNoSuchObjectLockConfiguration, "none", nil),
+				)
+			} else {
+				mockS3Iface.EXPECT().GetObjectRetentionWithContext(gomock.Any(), gomock.Any()).Return(
+					&s3.GetObjectRetentionOutput{
+						Retention: &s3.ObjectLockRetention{
+							Mode:            aws.String(test.mode),
+							RetainUntilDate: aws.Time(test.until),
+						},
+					},
+					nil,
+				)
+			}
+		}
+
+		reason, err := csbc.objectLockReason(context.Background(), planned)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if (test.expected == "") != (reason == "") ||
+			!strings.Contains(reason, test.expected) {
+			t.Errorf("Expected '%v' but got '%v'", test.expected, reason)
+		}
+		if planned.BypassGovernance != (test.bypass && reason == "" && test.mode == "GOVERNANCE") {
+			t.Errorf("Unexpected governance bypass for %v", test)
+		}
+		ctrl.Finish()
+	}
+}
+
+func TestObjectLockReasonStopsAtFirstLock(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	planned := &PlannedBucket{Bucket: bucket}
+	mockS3Iface.EXPECT().GetObjectLockConfigurationWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetObjectLockConfigurationOutput{
+			ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+				ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectVersionsWithContext(
+		gomock.Any(),
+		&s3.ListObjectVersionsInput{Bucket: bucket.Name},
+	).Return(
+		&s3.ListObjectVersionsOutput{
+			Versions: []*s3.ObjectVersion{
+				&s3.ObjectVersion{Key: aws.String("a"), VersionId: aws.String("v1")},
+			},
+			IsTruncated:         aws.Bool(true),
+			NextKeyMarker:       aws.String("a"),
+			NextVersionIdMarker: aws.String("v1"),
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectVersionsWithContext(
+		gomock.Any(),
+		&s3.ListObjectVersionsInput{
+			Bucket:          bucket.Name,
+			KeyMarker:       aws.String("a"),
+			VersionIdMarker: aws.String("v1"),
+		},
+	).Return(
+		&s3.ListObjectVersionsOutput{
+			Versions: []*s3.ObjectVersion{
+				&s3.ObjectVersion{Key: aws.String("a"), VersionId: aws.String("v0")},
+				&s3.ObjectVersion{Key: aws.String("b"), VersionId: aws.String("v2")},
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetObjectLegalHoldWithContext(
+		gomock.Any(),
+		&s3.GetObjectLegalHoldInput{Bucket: bucket.Name, Key: aws.String("a"), VersionId: aws.String("v1")},
+	).Return(&s3.GetObjectLegalHoldOutput{}, nil)
+	mockS3Iface.EXPECT().GetObjectRetentionWithContext(
+		gomock.Any(),
+		&s3.GetObjectRetentionInput{Bucket: bucket.Name, Key: aws.String("a"), VersionId: aws.String("v1")},
+	).Return(&s3.GetObjectRetentionOutput{}, nil)
+	mockS3Iface.EXPECT().GetObjectLegalHoldWithContext(
+		gomock.Any(),
+		&s3.GetObjectLegalHoldInput{Bucket: bucket.Name, Key: aws.String("a"), VersionId: aws.String("v0")},
+	).Return(
+		&s3.GetObjectLegalHoldOutput{
+			LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(s3.ObjectLockLegalHoldStatusOn)},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetObjectRetentionWithContext(
+		gomock.Any(),
+		&s3.GetObjectRetentionInput{Bucket: bucket.Name, Key: aws.String("a"), VersionId: aws.String("v0")},
+	).Return(&s3.GetObjectRetentionOutput{}, nil)
+
+	reason, err := csbc.objectLockReason(context.Background(), planned)
+	if err != nil || reason != "object lock: 1 under legal hold" {
+		t.Errorf("Expected the noncurrent version's legal hold but got '%v' and %v", reason, err)
+	}
+}
+
+func TestBypassGovernanceDeletesVersions(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface, bypassGovernance: true}
+	planned := &PlannedBucket{
+		Bucket:  bucket,
+		Objects: []*s3.Object{&s3.Object{Key: aws.String("a")}},
+	}
+	mockS3Iface.EXPECT().GetObjectLockConfigurationWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetObjectLockConfigurationOutput{
+			ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+				ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectVersionsWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.ListObjectVersionsOutput{
+			Versions: []*s3.ObjectVersion{
+				&s3.ObjectVersion{Key: aws.String("a"), VersionId: aws.String("v2")},
+				&s3.ObjectVersion{Key: aws.String("a"), VersionId: aws.String("v1")},
+			},
+			DeleteMarkers: []*s3.DeleteMarkerEntry{
+				&s3.DeleteMarkerEntry{Key: aws.String("b"), VersionId: aws.String("m1")},
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetObjectLegalHoldWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetObjectLegalHoldOutput{},
+		nil,
+	).Times(2)
+	mockS3Iface.EXPECT().GetObjectRetentionWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetObjectRetentionOutput{
+			Retention: &s3.ObjectLockRetention{
+				Mode:            aws.String(s3.ObjectLockRetentionModeGovernance),
+				RetainUntilDate: aws.Time(time.Now().Add(day)),
+			},
+		},
+		nil,
+	).Times(2)
+	gomock.InOrder(
+		mockS3Iface.EXPECT().DeleteObjectsWithContext(
+			gomock.Any(),
+			&s3.DeleteObjectsInput{
+				Bucket: bucket.Name,
+				Delete: &s3.Delete{
+					Objects: []*s3.ObjectIdentifier{
+						&s3.ObjectIdentifier{Key: aws.String("a"), VersionId: aws.String("v2")},
+						&s3.ObjectIdentifier{Key: aws.String("a"), VersionId: aws.String("v1")},
+						&s3.ObjectIdentifier{Key: aws.String("b"), VersionId: aws.String("m1")},
+					},
+				},
+				BypassGovernanceRetention: aws.Bool(true),
+			},
+		).Return(&s3.DeleteObjectsOutput{}, nil),
+		mockS3Iface.EXPECT().DeleteBucketWithContext(
+			gomock.Any(),
+			&s3.DeleteBucketInput{Bucket: bucket.Name},
+		).Return(&s3.DeleteBucketOutput{}, nil),
+	)
+
+	reason, err := csbc.objectLockReason(context.Background(), planned)
+	if err != nil || reason != "" {
+		t.Fatalf("Expected governance retention to be bypassed but got '%v' and %v", reason, err)
+	}
+	result := (&deleteAction{}).Apply(
+		context.Background(),
+		&ActionTarget{PlannedBucket: planned, S3: mockS3Iface, c: csbc},
+	)
+	if result.Outcome != OutcomeDeleted {
+		t.Errorf("Expected '%v' but got %v", OutcomeDeleted, result)
+	}
+}
+
+func TestDeleteObjectsBypassingGovernance(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+	csbc := &Cleaner{s3SVC: mockS3Iface}
+	ids := []*s3.ObjectIdentifier{&s3.ObjectIdentifier{Key: aws.String("a")}}
+	mockS3Iface.EXPECT().DeleteObjectsWithContext(
+		gomock.Any(),
+		&s3.DeleteObjectsInput{
+			Bucket:                    bucket.Name,
+			Delete:                    &s3.Delete{Objects: ids},
+			BypassGovernanceRetention: aws.Bool(true),
+		},
+	).Return(&s3.DeleteObjectsOutput{}, nil)
+
+	errs, err := csbc.deleteObjects(context.Background(), bucket, ids, true)
+	if err != nil || len(errs) != 0 {
+		t.Errorf("Unexpected errors %v and %v", errs, err)
+	}
+}
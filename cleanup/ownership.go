@@ -0,0 +1,250 @@
+package cleanup
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	DefaultOwnershipThreshold = 50
+	recentActivityWindow      = 7 * day
+
+	stackIDTag = "aws:cloudformation:stack-id"
+
+	weightStackResource  = 100
+	weightStackTag       = 80
+	weightDeadStackTag   = -40
+	weightNameMatch      = 20
+	weightCreationTime   = 30
+	weightRecentActivity = 20
+)
+
+// ownershipSignal is one piece of evidence that a live stack owns a bucket
+// and how much it counts towards the ownership score.
+type ownershipSignal struct {
+	name         string
+	contribution int
+	evidence     string
+}
+
+type ownershipScore struct {
+	signals []*ownershipSignal
+	owner   *cloudformation.StackSummary
+}
+
+func (s *ownershipScore) add(name string, contribution int, evidence string) {
+	s.signals = append(
+		s.signals,
+		&ownershipSignal{
+			name:         name,
+			contribution: contribution,
+			evidence:     evidence,
+		},
+	)
+}
+
+func (s *ownershipScore) total() int {
+	total := 0
+	for _, signal := range s.signals {
+		total += signal.contribution
+	}
+	return total
+}
+
+func (c *Cleaner) threshold() int {
+	if c.ownershipThreshold == 0 {
+		return DefaultOwnershipThreshold
+	}
+	return c.ownershipThreshold
+}
+
+func (c *Cleaner) isOwned(score *ownershipScore) bool {
+	return score.total() >= c.threshold()
+}
+
+// getStackBuckets maps every bucket declared as a resource of a live stack
+// to that stack.
+func (c *Cleaner) getStackBuckets(ctx context.Context) error {
+	c.stackBuckets = map[string]*cloudformation.StackSummary{}
+	for _, stack := range c.stacks {
+		resources, err := c.getStackResources(ctx, stack.StackId)
+		if err != nil {
+			return err
+		}
+		for _, resource := range resources {
+			if aws.StringValue(resource.ResourceType) == s3BucketResourceType &&
+				resource.PhysicalResourceId != nil {
+				c.stackBuckets[*resource.PhysicalResourceId] = stack
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Cleaner) findStackByID(stackID string) *cloudformation.StackSummary {
+	for _, stack := range c.stacks {
+		if aws.StringValue(stack.StackId) == stackID {
+			return stack
+		}
+	}
+	return nil
+}
+
+// nearestStack returns the live stack whose name appears in the bucket
+// name and whose creation time is closest to the bucket's.
+func (c *Cleaner) nearestStack(
+	bucket *s3.Bucket,
+) *cloudformation.StackSummary {
+	return nearestStackIn(bucket, c.stacks)
+}
+
+func nearestStackIn(
+	bucket *s3.Bucket,
+	stacks []*cloudformation.StackSummary,
+) *cloudformation.StackSummary {
+	var (
+		nearest *cloudformation.StackSummary
+		best    time.Duration
+	)
+	for _, stack := range stacks {
+		if !checkStackBucketbyName(*bucket.Name, *stack.StackName) {
+			continue
+		}
+		diff := aws.TimeValue(bucket.CreationDate).Sub(
+			aws.TimeValue(stack.CreationTime),
+		)
+		if diff < 0 {
+			diff = -diff
+		}
+		if nearest == nil || diff < best {
+			nearest, best = stack, diff
+		}
+	}
+	return nearest
+}
+
+func (c *Cleaner) scoreStackResource(
+	score *ownershipScore,
+	bucket *s3.Bucket,
+) {
+	if c.stackBuckets == nil {
+		score.add("stack resource", 0, "not checked")
+		return
+	}
+	stack, ok := c.stackBuckets[*bucket.Name]
+	if !ok {
+		score.add("stack resource", 0, "not a resource of any live stack")
+		return
+	}
+	score.owner = stack
+	score.add(
+		"stack resource",
+		weightStackResource,
+		"declared in live stack "+*stack.StackName,
+	)
+}
+
+func (c *Cleaner) scoreStackTags(
+	ctx context.Context,
+	score *ownershipScore,
+	bucket *s3.Bucket,
+) error {
+	tags, err := c.stackInventory().BucketTags(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	var stackID string
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == stackIDTag {
+			stackID = aws.StringValue(tag.Value)
+		}
+	}
+	if stackID == "" {
+		score.add("cloudformation tags", 0, "no "+stackIDTag+" tag")
+		return nil
+	}
+	stack := c.findStackByID(stackID)
+	if stack == nil {
+		score.add(
+			"cloudformation tags",
+			weightDeadStackTag,
+			"tagged with stack "+stackID+" which is not live",
+		)
+		return nil
+	}
+	if score.owner == nil {
+		score.owner = stack
+	}
+	score.add(
+		"cloudformation tags",
+		weightStackTag,
+		"tagged with live stack "+*stack.StackName,
+	)
+	return nil
+}
+
+func (c *Cleaner) scoreName(
+	ctx context.Context,
+	score *ownershipScore,
+	bucket *s3.Bucket,
+) error {
+	stack := c.nearestStack(bucket)
+	if stack == nil {
+		score.add("name", 0, "no live stack name in bucket name")
+		score.add("creation time", 0, "no stack to compare with")
+		return nil
+	}
+	score.add("name", weightNameMatch, "contains stack name "+*stack.StackName)
+	matched, evidence, err := c.matchCreationTime(ctx, bucket, stack)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		score.add("creation time", 0, evidence)
+		return nil
+	}
+	if score.owner == nil {
+		score.owner = stack
+	}
+	score.add("creation time", weightCreationTime, evidence)
+	return nil
+}
+
+// scoreOwnership combines the signals available without listing the
+// bucket. scoreActivity adds the last one once the contents are known.
+func (c *Cleaner) scoreOwnership(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (*ownershipScore, error) {
+	score := &ownershipScore{}
+	c.scoreStackResource(score, bucket)
+	if err := c.scoreStackTags(ctx, score, bucket); err != nil {
+		return nil, err
+	}
+	if err := c.scoreName(ctx, score, bucket); err != nil {
+		return nil, err
+	}
+	return score, nil
+}
+
+func scoreActivity(score *ownershipScore, objects []*s3.Object) {
+	newest := lastModified(objects)
+	if newest.IsZero() {
+		score.add("recent activity", 0, "no objects with a modification time")
+		return
+	}
+	idle := time.Since(newest)
+	if idle >= recentActivityWindow {
+		score.add("recent activity", 0, "last written "+formatDays(idle)+" ago")
+		return
+	}
+	score.add(
+		"recent activity",
+		weightRecentActivity,
+		"last written "+formatDays(idle)+" ago",
+	)
+}
@@ -0,0 +1,148 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func getOwnershipTestStacks() []*cloudformation.StackSummary {
+	return []*cloudformation.StackSummary{
+		&cloudformation.StackSummary{
+			StackId:      aws.String("arn:teststack1"),
+			StackName:    aws.String("teststack1"),
+			CreationTime: getTimeSecondsBeforeNow(1000),
+		},
+	}
+}
+
+func TestScoreOwnership(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	stacks := getOwnershipTestStacks()
+	var tests = []struct {
+		csbc   *Cleaner
+		bucket *s3.Bucket
+		tags   []*s3.Tag
+		total  int
+		owned  bool
+	}{
+		{
+			csbc:   &Cleaner{stacks: stacks, s3SVC: mockS3Iface},
+			bucket: &s3.Bucket{Name: aws.String("teststack1-a"), CreationDate: getTimeSecondsBeforeNow(990)},
+			total:  weightNameMatch + weightCreationTime,
+			owned:  true,
+		},
+		{
+			csbc:   &Cleaner{stacks: stacks, s3SVC: mockS3Iface},
+			bucket: &s3.Bucket{Name: aws.String("teststack1-b"), CreationDate: getTimeSecondsBeforeNow(5000)},
+			total:  weightNameMatch,
+			owned:  false,
+		},
+		{
+			csbc: &Cleaner{
+				stacks:       stacks,
+				stackBuckets: map[string]*cloudformation.StackSummary{"renamed-c": stacks[0]},
+				s3SVC:        mockS3Iface,
+			},
+			bucket: &s3.Bucket{Name: aws.String("renamed-c"), CreationDate: getTimeSecondsBeforeNow(5000)},
+			total:  weightStackResource,
+			owned:  true,
+		},
+		{
+			csbc:   &Cleaner{stacks: stacks, s3SVC: mockS3Iface},
+			bucket: &s3.Bucket{Name: aws.String("renamed-d"), CreationDate: getTimeSecondsBeforeNow(5000)},
+			tags: []*s3.Tag{
+				&s3.Tag{Key: aws.String(stackIDTag), Value: aws.String("arn:teststack1")},
+			},
+			total: weightStackTag,
+			owned: true,
+		},
+		{
+			csbc:   &Cleaner{stacks: stacks, s3SVC: mockS3Iface},
+			bucket: &s3.Bucket{Name: aws.String("teststack1-e"), CreationDate: getTimeSecondsBeforeNow(990)},
+			tags: []*s3.Tag{
+				&s3.Tag{Key: aws.String(stackIDTag), Value: aws.String("arn:deleted")},
+			},
+			total: weightNameMatch + weightCreationTime + weightDeadStackTag,
+			owned: false,
+		},
+	}
+	for _, test := range tests {
+		mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+			gomock.Any(),
+			&s3.GetBucketTaggingInput{Bucket: test.bucket.Name},
+		).Return(&s3.GetBucketTaggingOutput{TagSet: test.tags}, nil)
+		score, err := test.csbc.scoreOwnership(context.Background(), test.bucket)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if score.total() != test.total {
+			t.Errorf(
+				"Expected score %v for %v but got %v",
+				test.total,
+				*test.bucket.Name,
+				score.total(),
+			)
+		}
+		if test.csbc.isOwned(score) != test.owned {
+			t.Errorf("Expected owned '%v' for %v", test.owned, *test.bucket.Name)
+		}
+	}
+}
+
+func TestScoreActivity(t *testing.T) {
+	score := &ownershipScore{}
+	scoreActivity(score, []*s3.Object{
+		&s3.Object{LastModified: getTimeSecondsBeforeNow(3600)},
+	})
+	if score.total() != weightRecentActivity {
+		t.Errorf("Expected %v but got %v", weightRecentActivity, score.total())
+	}
+	score = &ownershipScore{}
+	scoreActivity(score, []*s3.Object{})
+	if score.total() != 0 || len(score.signals) != 1 {
+		t.Errorf("Expected a single zero signal but got %v", score.signals)
+	}
+}
+
+func TestGetStackBuckets(t *testing.T) {
+	mockCloudformationiface, _, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	csbc := &Cleaner{
+		cfSVC:  mockCloudformationiface,
+		stacks: getOwnershipTestStacks(),
+	}
+	mockCloudformationiface.EXPECT().ListStackResourcesWithContext(
+		gomock.Any(),
+		&cloudformation.ListStackResourcesInput{
+			StackName: aws.String("arn:teststack1"),
+		},
+	).Return(
+		&cloudformation.ListStackResourcesOutput{
+			StackResourceSummaries: []*cloudformation.StackResourceSummary{
+				&cloudformation.StackResourceSummary{
+					PhysicalResourceId: aws.String("teststack1-bucket"),
+					ResourceType:       aws.String(s3BucketResourceType),
+				},
+				&cloudformation.StackResourceSummary{
+					PhysicalResourceId: aws.String("teststack1-queue"),
+					ResourceType:       aws.String("AWS::SQS::Queue"),
+				},
+			},
+		},
+		nil,
+	)
+	if err := csbc.getStackBuckets(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(csbc.stackBuckets) != 1 || csbc.stackBuckets["teststack1-bucket"] == nil {
+		t.Errorf("Unexpected stack buckets %v", csbc.stackBuckets)
+	}
+}
@@ -0,0 +1,99 @@
+package cleanup
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Plan is what a run decided to do, computed without changing anything.
+type Plan struct {
+	// Prune is set when the plan deletes stale objects from shared
+	// buckets instead of deleting whole buckets.
+	Prune bool
+	// Action is the name of the action Apply carries out on Buckets.
+	Action  string
+	Buckets []*PlannedBucket
+	// Report lists the buckets that were considered and kept or skipped.
+	Report []*ReportEntry
+	// Stacks are the live stacks the plan was decided against.
+	Stacks []*cloudformation.StackSummary
+}
+
+// Result is what Apply did.
+type Result struct {
+	Report []*ReportEntry
+	// Errors are the objects DeleteObjects failed to delete.
+	Errors []*s3.Error
+}
+
+// Plan loads the live stacks and decides which buckets to remove, or
+// which objects to prune with Options.PruneShared.
+func (c *Cleaner) Plan(ctx context.Context) (*Plan, error) {
+	c.report = nil
+	if err := c.loadStacks(ctx); err != nil {
+		return nil, err
+	}
+	plan := &Plan{Prune: c.pruneShared, Action: c.bucketAction().Name()}
+	var err error
+	if c.pruneShared {
+		plan.Buckets, err = c.planSharedPrune(ctx)
+	} else {
+		plan.Buckets, err = c.planBucketRemoval(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	plan.Report = c.takeReport()
+	plan.Stacks = c.stacks
+	return plan, nil
+}
+
+// RemovesData reports whether applying the plan deletes objects, which
+// is what the run limits cap.
+func (p *Plan) RemovesData() bool {
+	return p.Prune || removesData(p.Action)
+}
+
+// CheckLimits holds the plans of several runs, such as every rule and
+// region of a config, against the run limits together, so splitting a
+// deletion across runs does not get around them. Plans that do not remove
+// data are left out. A dry run only logs the violation.
+func (c *Cleaner) CheckLimits(plans []*Plan) error {
+	var buckets []*PlannedBucket
+	for _, plan := range plans {
+		if plan.RemovesData() {
+			buckets = append(buckets, plan.Buckets...)
+		}
+	}
+	return c.enforceLimits(buckets)
+}
+
+// Apply carries out a plan once it is within the run limits. On error
+// the result still reports what was done before the failure.
+func (c *Cleaner) Apply(ctx context.Context, plan *Plan) (*Result, error) {
+	result := &Result{}
+	var err error
+	if plan.Prune {
+		result.Errors, err = c.pruneBuckets(ctx, plan.Buckets)
+	} else {
+		result.Errors, err = c.removeBuckets(ctx, plan.Buckets)
+	}
+	result.Report = c.takeReport()
+	return result, err
+}
+
+// Explain writes every ownership signal for a bucket and the verdict a
+// run would reach to out.
+func (c *Cleaner) Explain(
+	ctx context.Context,
+	out io.Writer,
+	bucketName string,
+) error {
+	if err := c.loadStacks(ctx); err != nil {
+		return err
+	}
+	return c.explain(ctx, out, bucketName)
+}
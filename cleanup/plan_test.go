@@ -0,0 +1,154 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+type testLogger struct {
+	lines int
+}
+
+func (l *testLogger) Log(v ...interface{}) {
+	l.lines++
+}
+
+func TestNew(t *testing.T) {
+	var tests = []struct {
+		options Options
+		ok      bool
+	}{
+		{options: Options{}, ok: true},
+		{options: Options{Action: ActionQuarantine, Ownership: OwnershipStrategyScore}, ok: true},
+		{options: Options{Action: "archive"}, ok: false},
+		{options: Options{Ownership: "tags"}, ok: false},
+		{options: Options{Policy: "owner == 1"}, ok: false},
+	}
+	for _, test := range tests {
+		cleaner, err := New(test.options)
+		if (err == nil) != test.ok {
+			t.Errorf("Expected ok '%v' for %+v but got %v", test.ok, test.options, err)
+		}
+		if err == nil && (cleaner.action == nil || cleaner.window().after != DefaultCreationWindow) {
+			t.Errorf("Expected defaults to be filled in but got %+v", cleaner)
+		}
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	mockCloudformationiface, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	logger := &testLogger{}
+	cleaner, err := New(
+		Options{
+			S3:                 mockS3Iface,
+			CloudFormation:     mockCloudformationiface,
+			Logger:             logger,
+			BucketFilter:       "s3BucketTest",
+			IgnoreRetain:       true,
+			SkipReferenceCheck: true,
+		},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	orphan := &s3.Bucket{
+		CreationDate: getTimeSecondsBeforeNow(300),
+		Name:         aws.String("oldstack-s3BucketTest"),
+	}
+	mockCloudformationiface.EXPECT().ListStacksWithContext(gomock.Any(), gomock.Any()).Return(
+		&cloudformation.ListStacksOutput{},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{orphan}},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketTaggingOutput{},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetBucketReplicationWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New(errCodeReplicationConfigurationNotFound, "none", nil),
+	)
+	mockS3Iface.EXPECT().GetBucketLoggingWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketLoggingOutput{},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetBucketNotificationConfigurationWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.NotificationConfiguration{},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: orphan.Name},
+	).Return(&s3.ListObjectsOutput{}, nil)
+	mockS3Iface.EXPECT().GetObjectLockConfigurationWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New(errCodeObjectLockConfigurationNotFound, "none", nil),
+	)
+
+	plan, err := cleaner.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if plan.Prune || len(plan.Buckets) != 1 || plan.Buckets[0].Bucket != orphan {
+		t.Fatalf("Expected a plan to delete %v but got %+v", *orphan.Name, plan)
+	}
+
+	mockS3Iface.EXPECT().DeleteBucketWithContext(
+		gomock.Any(),
+		&s3.DeleteBucketInput{Bucket: orphan.Name},
+	).Return(&s3.DeleteBucketOutput{}, nil)
+
+	result, err := cleaner.Apply(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(result.Report) != 1 || result.Report[0].Outcome != OutcomeDeleted {
+		t.Errorf("Expected the bucket to be reported deleted but got %v", result.Report)
+	}
+	if logger.lines == 0 {
+		t.Errorf("Expected progress to go to the logger")
+	}
+}
+
+func TestPlanReturnsErrors(t *testing.T) {
+	mockCloudformationiface, _, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	cleaner, _ := New(Options{CloudFormation: mockCloudformationiface})
+	failure := errors.New("access denied")
+	mockCloudformationiface.EXPECT().ListStacksWithContext(gomock.Any(), gomock.Any()).Return(nil, failure)
+
+	if _, err := cleaner.Plan(context.Background()); err != failure {
+		t.Errorf("Expected error '%v' but got '%v'", failure, err)
+	}
+}
+
+func TestApplyStopsWhenCancelled(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	cleaner, _ := New(Options{S3: mockS3Iface})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	plan := &Plan{
+		Buckets: []*PlannedBucket{
+			&PlannedBucket{Bucket: &s3.Bucket{Name: aws.String("bucket1")}},
+		},
+	}
+	result, err := cleaner.Apply(ctx, plan)
+	if err != context.Canceled || len(result.Report) != 0 {
+		t.Errorf("Expected a cancelled run without changes but got %v and %v", err, result.Report)
+	}
+}
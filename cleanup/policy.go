@@ -0,0 +1,104 @@
+package cleanup
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// policyValues accepts both forms IAM allows for Action and Resource: a
+// single string or a list of them.
+type policyValues []string
+
+func (v *policyValues) UnmarshalJSON(data []byte) error {
+	var values []string
+	if err := json.Unmarshal(data, &values); err == nil {
+		*v = values
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*v = policyValues{value}
+	return nil
+}
+
+// matches reports whether any of the values, which may contain the IAM
+// wildcards * and ?, matches s.
+func (v policyValues) matches(s string, ignoreCase bool) bool {
+	for _, value := range v {
+		pattern := regexp.QuoteMeta(value)
+		pattern = strings.Replace(pattern, `\*`, ".*", -1)
+		pattern = strings.Replace(pattern, `\?`, ".", -1)
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		if regexp.MustCompile("^" + pattern + "$").MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+type policyStatement struct {
+	Sid       string
+	Effect    string
+	Action    policyValues
+	NotAction policyValues
+	Resource  policyValues
+	Condition map[string]interface{}
+}
+
+// appliesTo reports whether the statement covers action on resource.
+func (s *policyStatement) appliesTo(action string, resource string) bool {
+	if len(s.NotAction) > 0 {
+		if s.NotAction.matches(action, true) {
+			return false
+		}
+	} else if !s.Action.matches(action, true) {
+		return false
+	}
+	return len(s.Resource) == 0 || s.Resource.matches(resource, false)
+}
+
+// policyStatements accepts both forms IAM allows for the Statement element:
+// a single statement object or a list of them.
+type policyStatements []*policyStatement
+
+type bucketPolicy struct {
+	Version   string
+	Statement policyStatements
+}
+
+func (s *policyStatements) UnmarshalJSON(data []byte) error {
+	var statements []*policyStatement
+	if err := json.Unmarshal(data, &statements); err == nil {
+		*s = statements
+		return nil
+	}
+	var statement policyStatement
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return err
+	}
+	*s = policyStatements{&statement}
+	return nil
+}
+
+func parseBucketPolicy(policy string) (*bucketPolicy, error) {
+	result := &bucketPolicy{}
+	if policy == "" {
+		return result, nil
+	}
+	err := json.Unmarshal([]byte(policy), result)
+	return result, err
+}
+
+func (p *bucketPolicy) hasStatement(sid string) bool {
+	for _, statement := range p.Statement {
+		if statement.Sid == sid {
+			return true
+		}
+	}
+	return false
+}
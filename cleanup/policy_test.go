@@ -0,0 +1,77 @@
+package cleanup
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseBucketPolicy(t *testing.T) {
+	var happyPathTests = []struct {
+		policy string
+		sid    string
+	}{
+		{
+			policy: `{"Version":"2012-10-17","Statement":[{"Sid":"CleanupProtect","Effect":"Deny"}]}`,
+			sid:    "CleanupProtect",
+		},
+		{
+			policy: `{"Version":"2012-10-17","Statement":{"Sid":"CleanupProtect","Effect":"Deny"}}`,
+			sid:    "CleanupProtect",
+		},
+	}
+	for _, test := range happyPathTests {
+		policy, err := parseBucketPolicy(test.policy)
+		if err != nil {
+			t.Errorf("Expected no error but got %v", err)
+			continue
+		}
+		if !policy.hasStatement(test.sid) {
+			t.Errorf("Expected policy to contain statement %v", test.sid)
+		}
+		if policy.hasStatement("SomethingElse") {
+			t.Errorf("Expected policy not to contain statement SomethingElse")
+		}
+	}
+
+	policy, err := parseBucketPolicy("")
+	if err != nil || len(policy.Statement) != 0 {
+		t.Errorf("Expected an empty policy but got %v, %v", policy, err)
+	}
+
+	if _, err := parseBucketPolicy(`{"Statement":"nope"}`); err == nil {
+		t.Errorf("Expected an error for a malformed policy")
+	}
+}
+
+func TestPolicyStatementAppliesTo(t *testing.T) {
+	var tests = []struct {
+		statement string
+		action    string
+		resource  string
+		expected  bool
+	}{
+		{`{"Action": "s3:*", "Resource": "*"}`, "s3:DeleteBucket", "arn:aws:s3:::a", true},
+		{`{"Action": ["s3:Delete*"], "Resource": "arn:aws:s3:::a/*"}`, "s3:DeleteObject", "arn:aws:s3:::a/*", true},
+		{`{"Action": "s3:delete*", "Resource": "arn:aws:s3:::a/*"}`, "s3:DeleteBucket", "arn:aws:s3:::a", false},
+		{`{"Action": "s3:DeleteObject?ersion", "Resource": "arn:aws:s3:::a/*"}`, "s3:DeleteObjectVersion", "arn:aws:s3:::a/*", true},
+		{`{"NotAction": "s3:GetObject", "Resource": "arn:aws:s3:::a"}`, "s3:DeleteBucket", "arn:aws:s3:::a", true},
+		{`{"NotAction": "s3:*", "Resource": "arn:aws:s3:::a"}`, "s3:DeleteBucket", "arn:aws:s3:::a", false},
+		{`{"Action": "s3:GetObject"}`, "s3:DeleteObject", "arn:aws:s3:::a/*", false},
+	}
+	for _, test := range tests {
+		statement := &policyStatement{}
+		if err := json.Unmarshal([]byte(test.statement), statement); err != nil {
+			t.Errorf("Unexpected error %v", err)
+			continue
+		}
+		if result := statement.appliesTo(test.action, test.resource); result != test.expected {
+			t.Errorf(
+				"Expected %v for %v on %v with %v",
+				test.expected,
+				test.action,
+				test.resource,
+				test.statement,
+			)
+		}
+	}
+}
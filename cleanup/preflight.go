@@ -0,0 +1,159 @@
+package cleanup
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	mfaDeleteEnabled = "Enabled"
+	// pruneAction stands for the pruning of shared buckets.
+	pruneAction = "prune"
+)
+
+// actionPermissions are the S3 actions each built-in action needs on a
+// bucket. Other actions are checked as if they deleted the bucket.
+var actionPermissions = map[string][]string{
+	ActionReport:            nil,
+	pruneAction:             {"s3:DeleteObject"},
+	ActionTag:               {"s3:PutBucketTagging"},
+	ActionQuarantine:        {"s3:PutBucketTagging", "s3:PutBucketPolicy"},
+	ActionLifecycleExpire:   {"s3:PutLifecycleConfiguration", "s3:PutBucketTagging", "s3:DeleteBucket"},
+	ActionBatchManifest:     {"s3:PutBucketTagging", "s3:DeleteBucket"},
+	ActionArchiveThenDelete: {"s3:GetObject", "s3:DeleteObject", "s3:DeleteObjectVersion", "s3:DeleteBucket"},
+	ActionDelete:            {"s3:DeleteObject", "s3:DeleteObjectVersion", "s3:DeleteBucket"},
+}
+
+// removesObjects lists the actions MFA delete gets in the way of.
+var removesObjects = []string{
+	ActionLifecycleExpire,
+	ActionBatchManifest,
+	ActionArchiveThenDelete,
+	ActionDelete,
+}
+
+func requiredPermissions(action string) []string {
+	permissions, ok := actionPermissions[action]
+	if !ok {
+		return actionPermissions[ActionDelete]
+	}
+	return permissions
+}
+
+// policyResource is the resource a permission is checked against: the
+// bucket itself, or its objects for object actions.
+func policyResource(bucket *s3.Bucket, permission string) string {
+	arn := "arn:aws:s3:::" + *bucket.Name
+	if strings.HasPrefix(permission, "s3:DeleteObject") ||
+		strings.HasPrefix(permission, "s3:GetObject") {
+		return arn + "/*"
+	}
+	return arn
+}
+
+// policyDenials lists the bucket policy statements that explicitly deny
+// one of the permissions. The principal is not resolved, so a deny aimed
+// at another principal is reported too.
+func (c *Cleaner) policyDenials(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	permissions []string,
+) ([]string, error) {
+	policy, err := c.getBucketPolicy(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	var denials []string
+	for _, statement := range policy.Statement {
+		if !strings.EqualFold(statement.Effect, "Deny") {
+			continue
+		}
+		var denied []string
+		for _, permission := range permissions {
+			if statement.appliesTo(permission, policyResource(bucket, permission)) {
+				denied = append(denied, permission)
+			}
+		}
+		if len(denied) == 0 {
+			continue
+		}
+		denial := strings.Join(denied, ", ") + " denied by bucket policy"
+		if statement.Sid != "" {
+			denial += " statement " + statement.Sid
+		}
+		if len(statement.Condition) > 0 {
+			denial += " (conditional)"
+		}
+		denials = append(denials, denial)
+	}
+	return denials, nil
+}
+
+func (c *Cleaner) hasMFADelete(ctx context.Context, bucket *s3.Bucket) (bool, error) {
+	resp, err := c.s3SVC.GetBucketVersioningWithContext(
+		ctx,
+		&s3.GetBucketVersioningInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return aws.StringValue(resp.MFADelete) == mfaDeleteEnabled, nil
+}
+
+// preflightProblems lists why applying the action to the bucket would
+// fail partway.
+func (c *Cleaner) preflightProblems(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	action string,
+) ([]string, error) {
+	permissions := requiredPermissions(action)
+	if len(permissions) == 0 {
+		return nil, nil
+	}
+	problems, err := c.policyDenials(ctx, bucket, permissions)
+	if err != nil || !contains(removesObjects, action) {
+		return problems, err
+	}
+	mfaDelete, err := c.hasMFADelete(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if mfaDelete {
+		problems = append(problems, "MFA delete is enabled, object versions cannot be removed")
+	}
+	return problems, nil
+}
+
+// Preflight checks, without changing anything, whether the plan's action
+// would fail on any of its buckets because of a bucket policy deny or
+// MFA delete. Every bucket is reported as ready or as would fail.
+func (c *Cleaner) Preflight(
+	ctx context.Context,
+	plan *Plan,
+) ([]*ReportEntry, error) {
+	action := c.bucketAction().Name()
+	if plan.Prune {
+		action = pruneAction
+	}
+	for _, planned := range plan.Buckets {
+		if err := ctx.Err(); err != nil {
+			return c.takeReport(), err
+		}
+		problems, err := c.preflightProblems(ctx, planned.Bucket, action)
+		if err != nil {
+			return c.takeReport(), err
+		}
+		if len(problems) == 0 {
+			c.recordBucket(planned.Bucket, OutcomeReady, action)
+			continue
+		}
+		c.recordBucket(planned.Bucket, OutcomeWouldFail, strings.Join(problems, "; "))
+	}
+	return c.takeReport(), nil
+}
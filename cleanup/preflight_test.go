@@ -0,0 +1,94 @@
+package cleanup
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestPreflight(t *testing.T) {
+	var tests = []struct {
+		action    Action
+		policy    string
+		mfaDelete string
+		expected  string
+		reason    string
+	}{
+		{action: &deleteAction{}, expected: OutcomeReady, reason: ActionDelete},
+		{
+			action:   &deleteAction{},
+			policy:   `{"Statement":{"Sid":"NoDelete","Effect":"Deny","Principal":"*","Action":"s3:DeleteBucket","Resource":"arn:aws:s3:::team-a-logs"}}`,
+			expected: OutcomeWouldFail,
+			reason:   "s3:DeleteBucket denied by bucket policy statement NoDelete",
+		},
+		{
+			action:   &deleteAction{},
+			policy:   `{"Statement":[{"Effect":"Deny","Action":"s3:Delete*","Resource":"arn:aws:s3:::team-a-logs/*","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"false"}}}]}`,
+			expected: OutcomeWouldFail,
+			reason:   "s3:DeleteObject, s3:DeleteObjectVersion denied by bucket policy (conditional)",
+		},
+		{
+			action:   &deleteAction{},
+			policy:   `{"Statement":[{"Effect":"Deny","Action":"s3:GetObject","Resource":"arn:aws:s3:::team-a-logs/*"}]}`,
+			expected: OutcomeReady,
+			reason:   ActionDelete,
+		},
+		{
+			action:    &deleteAction{},
+			mfaDelete: "Enabled",
+			expected:  OutcomeWouldFail,
+			reason:    "MFA delete is enabled",
+		},
+		{
+			action:    &tagAction{},
+			policy:    `{"Statement":[{"Effect":"Deny","Action":"s3:DeleteBucket","Resource":"*"}]}`,
+			mfaDelete: "Enabled",
+			expected:  OutcomeReady,
+			reason:    ActionTag,
+		},
+	}
+	for _, test := range tests {
+		_, mockS3Iface, ctrl := getMocks(t)
+
+		bucket := &s3.Bucket{Name: aws.String("team-a-logs")}
+		csbc := &Cleaner{s3SVC: mockS3Iface, action: test.action}
+		if test.policy == "" {
+			mockS3Iface.EXPECT().GetBucketPolicyWithContext(gomock.Any(), gomock.Any()).Return(
+				nil,
+				awserr.New(errCodeNoSuchBucketPolicy, "none", nil),
+			)
+		} else {
+			mockS3Iface.EXPECT().GetBucketPolicyWithContext(gomock.Any(), gomock.Any()).Return(
+				&s3.GetBucketPolicyOutput{Policy: aws.String(test.policy)},
+				nil,
+			)
+		}
+		if test.action.Name() == ActionDelete {
+			mockS3Iface.EXPECT().GetBucketVersioningWithContext(
+				gomock.Any(),
+				&s3.GetBucketVersioningInput{Bucket: bucket.Name},
+			).Return(
+				&s3.GetBucketVersioningOutput{MFADelete: aws.String(test.mfaDelete)},
+				nil,
+			)
+		}
+
+		report, err := csbc.Preflight(
+			context.Background(),
+			&Plan{Buckets: []*PlannedBucket{&PlannedBucket{Bucket: bucket}}},
+		)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		} else if len(report) != 1 ||
+			report[0].Outcome != test.expected ||
+			!strings.Contains(report[0].Reason, test.reason) {
+			t.Errorf("Expected '%v: %v' but got %v", test.expected, test.reason, report)
+		}
+		ctrl.Finish()
+	}
+}
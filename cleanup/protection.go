@@ -0,0 +1,103 @@
+package cleanup
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	errCodeNoSuchTagSet       = "NoSuchTagSet"
+	errCodeNoSuchBucketPolicy = "NoSuchBucketPolicy"
+)
+
+func isAWSErrorCode(err error, code string) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == code
+}
+
+func hasTag(tags []*s3.Tag, key string, value string) bool {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key &&
+			(value == "" || aws.StringValue(tag.Value) == value) {
+			return true
+		}
+	}
+	return false
+}
+
+func tagValue(tags []*s3.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
+func (c *Cleaner) getBucketTags(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) ([]*s3.Tag, error) {
+	resp, err := c.s3SVC.GetBucketTaggingWithContext(
+		ctx,
+		&s3.GetBucketTaggingInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if isAWSErrorCode(err, errCodeNoSuchTagSet) {
+		return []*s3.Tag{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.TagSet, nil
+}
+
+func (c *Cleaner) getBucketPolicy(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (*bucketPolicy, error) {
+	resp, err := c.s3SVC.GetBucketPolicyWithContext(
+		ctx,
+		&s3.GetBucketPolicyInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if isAWSErrorCode(err, errCodeNoSuchBucketPolicy) {
+		return &bucketPolicy{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseBucketPolicy(aws.StringValue(resp.Policy))
+}
+
+// protectionReason reports whether the bucket has opted out of cleanup
+// through the protect tag or the protect policy statement.
+func (c *Cleaner) protectionReason(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (string, error) {
+	if c.protectTagKey != "" {
+		tags, err := c.getBucketTags(ctx, bucket)
+		if err != nil {
+			return "", err
+		}
+		if hasTag(tags, c.protectTagKey, c.protectTagValue) {
+			return "protected by tag " + c.protectTagKey + "=" + c.protectTagValue, nil
+		}
+	}
+	if c.protectPolicySid != "" {
+		policy, err := c.getBucketPolicy(ctx, bucket)
+		if err != nil {
+			return "", err
+		}
+		if policy.hasStatement(c.protectPolicySid) {
+			return "protected by bucket policy statement " + c.protectPolicySid, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,151 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestHasTag(t *testing.T) {
+	tags := []*s3.Tag{
+		&s3.Tag{Key: aws.String("cleanup:protect"), Value: aws.String("true")},
+		&s3.Tag{Key: aws.String("env"), Value: aws.String("prod")},
+	}
+	var tests = []struct {
+		key      string
+		value    string
+		expected bool
+	}{
+		{key: "cleanup:protect", value: "true", expected: true},
+		{key: "env", value: "", expected: true},
+		{key: "cleanup:protect", value: "false", expected: false},
+		{key: "owner", value: "", expected: false},
+	}
+	for _, test := range tests {
+		result := hasTag(tags, test.key, test.value)
+		if result != test.expected {
+			t.Errorf("Expected output of '%v' but got '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestProtectionReason(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	bucket := &s3.Bucket{Name: aws.String("teststack1-s3BucketTest")}
+	csbc := &Cleaner{
+		s3SVC:            mockS3Iface,
+		protectTagKey:    "cleanup:protect",
+		protectTagValue:  "true",
+		protectPolicySid: "CleanupProtect",
+	}
+
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(
+		&s3.GetBucketTaggingOutput{
+			TagSet: []*s3.Tag{
+				&s3.Tag{
+					Key:   aws.String("cleanup:protect"),
+					Value: aws.String("true"),
+				},
+			},
+		},
+		nil,
+	)
+	if reason, err := csbc.protectionReason(ctx, bucket); err != nil || reason == "" {
+		t.Errorf("Expected bucket to be protected by tag")
+	}
+
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(nil, awserr.New(errCodeNoSuchTagSet, "no tags", nil))
+	mockS3Iface.EXPECT().GetBucketPolicyWithContext(
+		gomock.Any(),
+		&s3.GetBucketPolicyInput{Bucket: bucket.Name},
+	).Return(
+		&s3.GetBucketPolicyOutput{
+			Policy: aws.String(
+				`{"Statement":{"Sid":"CleanupProtect","Effect":"Deny"}}`,
+			),
+		},
+		nil,
+	)
+	if reason, err := csbc.protectionReason(ctx, bucket); err != nil || reason == "" {
+		t.Errorf("Expected bucket to be protected by policy statement")
+	}
+
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(nil, awserr.New(errCodeNoSuchTagSet, "no tags", nil))
+	mockS3Iface.EXPECT().GetBucketPolicyWithContext(
+		gomock.Any(),
+		&s3.GetBucketPolicyInput{Bucket: bucket.Name},
+	).Return(nil, awserr.New(errCodeNoSuchBucketPolicy, "no policy", nil))
+	if reason, err := csbc.protectionReason(ctx, bucket); err != nil || reason != "" {
+		t.Errorf("Expected bucket to be unprotected but got '%v'", reason)
+	}
+
+	if reason, _ := (&Cleaner{}).protectionReason(ctx, bucket); reason != "" {
+		t.Errorf("Expected no checks without configuration but got '%v'", reason)
+	}
+}
+
+func TestRemoveUnusedCFBucketsSkipsProtected(t *testing.T) {
+	mockCloudformationiface, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{
+		CreationDate: getTimeSecondsBeforeNow(300),
+		Name:         aws.String("testS3Removal2s3BucketTest"),
+	}
+	csbc := &Cleaner{
+		s3SVC: mockS3Iface,
+		cfSVC: mockCloudformationiface,
+		stacks: []*cloudformation.StackSummary{
+			&cloudformation.StackSummary{
+				StackName:    aws.String("testS3"),
+				CreationTime: getTimeSecondsBeforeNow(30),
+			},
+		},
+		bucketFilter:    "s3BucketTest",
+		protectTagKey:   "cleanup:protect",
+		protectTagValue: "true",
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket}},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(
+		&s3.GetBucketTaggingOutput{
+			TagSet: []*s3.Tag{
+				&s3.Tag{
+					Key:   aws.String("cleanup:protect"),
+					Value: aws.String("true"),
+				},
+			},
+		},
+		nil,
+	).Times(2)
+
+	errs := runRemoval(t, csbc)
+	if len(errs) > 0 {
+		t.Errorf("Expected 0 errors but got %v", len(errs))
+	}
+	if len(csbc.report) != 1 || csbc.report[0].Outcome != OutcomeSkipped {
+		t.Errorf("Expected a single skipped report entry but got %v", csbc.report)
+	}
+}
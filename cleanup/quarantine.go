@@ -0,0 +1,288 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	quarantineTag = "cleanup:quarantined"
+	quarantineSid = "CleanupQuarantine"
+)
+
+// exemptUserID turns the caller's user id into the aws:userid pattern
+// the quarantine statement exempts. An assumed role's id ends with the
+// session name, so every session of the role is exempted.
+func exemptUserID(callerUserID string) string {
+	if i := strings.Index(callerUserID, ":"); i >= 0 {
+		return callerUserID[:i] + ":*"
+	}
+	return callerUserID
+}
+
+// quarantineStatement denies everyone but the tool's own principal
+// reading and writing objects while leaving bucket management alone, so
+// a later run can still archive and delete the bucket.
+func quarantineStatement(bucketName string, callerUserID string) map[string]interface{} {
+	return map[string]interface{}{
+		"Sid":       quarantineSid,
+		"Effect":    "Deny",
+		"Principal": "*",
+		"Action":    []string{"s3:GetObject", "s3:PutObject"},
+		"Resource":  "arn:aws:s3:::" + bucketName + "/*",
+		"Condition": map[string]interface{}{
+			"StringNotLike": map[string]interface{}{
+				"aws:userid": exemptUserID(callerUserID),
+			},
+		},
+	}
+}
+
+// parsePolicyStatements parses a policy document and returns it with its
+// statements, a single statement object included.
+func parsePolicyStatements(policy string) (map[string]interface{}, []interface{}, error) {
+	document := map[string]interface{}{"Version": "2012-10-17"}
+	if policy != "" {
+		if err := json.Unmarshal([]byte(policy), &document); err != nil {
+			return nil, nil, err
+		}
+	}
+	var statements []interface{}
+	switch existing := document["Statement"].(type) {
+	case []interface{}:
+		statements = existing
+	case map[string]interface{}:
+		statements = []interface{}{existing}
+	}
+	return document, statements, nil
+}
+
+// addQuarantineStatement appends the quarantine statement to a policy
+// document, keeping every existing statement as is.
+func addQuarantineStatement(
+	policy string,
+	bucketName string,
+	callerUserID string,
+) (string, error) {
+	document, statements, err := parsePolicyStatements(policy)
+	if err != nil {
+		return "", err
+	}
+	document["Statement"] = append(
+		statements,
+		quarantineStatement(bucketName, callerUserID),
+	)
+	result, err := json.Marshal(document)
+	return string(result), err
+}
+
+func isQuarantineStatement(statement interface{}) bool {
+	fields, ok := statement.(map[string]interface{})
+	return ok && fields["Sid"] == quarantineSid
+}
+
+// hasQuarantineStatement reports whether a policy document already holds
+// the quarantine statement.
+func hasQuarantineStatement(policy string) (bool, error) {
+	_, statements, err := parsePolicyStatements(policy)
+	if err != nil {
+		return false, err
+	}
+	for _, statement := range statements {
+		if isQuarantineStatement(statement) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// removeQuarantineStatement drops the quarantine statement from a policy
+// document. It returns an empty policy when no statement is left.
+func removeQuarantineStatement(policy string) (string, error) {
+	document, statements, err := parsePolicyStatements(policy)
+	if err != nil {
+		return "", err
+	}
+	var kept []interface{}
+	for _, statement := range statements {
+		if isQuarantineStatement(statement) {
+			continue
+		}
+		kept = append(kept, statement)
+	}
+	if len(kept) == 0 {
+		return "", nil
+	}
+	document["Statement"] = kept
+	result, err := json.Marshal(document)
+	return string(result), err
+}
+
+func (c *Cleaner) getBucketPolicyDocument(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (string, error) {
+	resp, err := c.s3SVC.GetBucketPolicyWithContext(
+		ctx,
+		&s3.GetBucketPolicyInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if isAWSErrorCode(err, errCodeNoSuchBucketPolicy) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.Policy), nil
+}
+
+// addBucketTag adds a tag to the bucket's tag set. It returns false,
+// changing nothing, when the bucket already has the key.
+func (c *Cleaner) addBucketTag(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	key string,
+	value string,
+) (bool, error) {
+	tags, err := c.getBucketTags(ctx, bucket)
+	if err != nil || hasTag(tags, key, "") {
+		return false, err
+	}
+	tags = append(
+		tags,
+		&s3.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(value),
+		},
+	)
+	_, err = c.s3SVC.PutBucketTaggingWithContext(
+		ctx,
+		&s3.PutBucketTaggingInput{
+			Bucket:  bucket.Name,
+			Tagging: &s3.Tagging{TagSet: tags},
+		},
+	)
+	return err == nil, err
+}
+
+// removeBucketTag removes a tag from the bucket's tag set, deleting the
+// tag set when it was the last tag.
+func (c *Cleaner) removeBucketTag(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	key string,
+) error {
+	existing, err := c.getBucketTags(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	var tags []*s3.Tag
+	for _, tag := range existing {
+		if aws.StringValue(tag.Key) != key {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		_, err = c.s3SVC.DeleteBucketTaggingWithContext(
+			ctx,
+			&s3.DeleteBucketTaggingInput{
+				Bucket: bucket.Name,
+			},
+		)
+	} else {
+		_, err = c.s3SVC.PutBucketTaggingWithContext(
+			ctx,
+			&s3.PutBucketTaggingInput{
+				Bucket:  bucket.Name,
+				Tagging: &s3.Tagging{TagSet: tags},
+			},
+		)
+	}
+	return err
+}
+
+// quarantineBucket blocks object access and tags the bucket with the time
+// it was quarantined. It returns false if it was already quarantined,
+// which the quarantine statement in the bucket policy decides: the tag is
+// written last, so a failed policy write is retried by the next run.
+func (c *Cleaner) quarantineBucket(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (bool, error) {
+	if c.callerUserID == "" {
+		return false, errors.New("quarantine needs Options.CallerUserID to exempt the tool")
+	}
+	document, err := c.getBucketPolicyDocument(ctx, bucket)
+	if err != nil {
+		return false, err
+	}
+	quarantined, err := hasQuarantineStatement(document)
+	if err != nil {
+		return false, err
+	}
+	if !quarantined {
+		policy, err := addQuarantineStatement(document, *bucket.Name, c.callerUserID)
+		if err != nil {
+			return false, err
+		}
+		_, err = c.s3SVC.PutBucketPolicyWithContext(
+			ctx,
+			&s3.PutBucketPolicyInput{
+				Bucket: bucket.Name,
+				Policy: aws.String(policy),
+			},
+		)
+		if err != nil {
+			return false, err
+		}
+	}
+	if _, err := c.addBucketTag(ctx, bucket, quarantineTag, timestamp()); err != nil {
+		return false, err
+	}
+	return !quarantined, nil
+}
+
+// Unquarantine lifts the quarantine of the named bucket: it removes the
+// quarantine statement from the bucket policy, deleting the policy when
+// nothing else is left in it, and clears the quarantine tag.
+func (c *Cleaner) Unquarantine(ctx context.Context, name string) error {
+	bucket := &s3.Bucket{Name: aws.String(name)}
+	document, err := c.getBucketPolicyDocument(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	policy, err := removeQuarantineStatement(document)
+	if err != nil {
+		return err
+	}
+	if policy == "" {
+		_, err = c.s3SVC.DeleteBucketPolicyWithContext(
+			ctx,
+			&s3.DeleteBucketPolicyInput{
+				Bucket: bucket.Name,
+			},
+		)
+	} else {
+		_, err = c.s3SVC.PutBucketPolicyWithContext(
+			ctx,
+			&s3.PutBucketPolicyInput{
+				Bucket: bucket.Name,
+				Policy: aws.String(policy),
+			},
+		)
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.removeBucketTag(ctx, bucket, quarantineTag); err != nil {
+		return err
+	}
+	c.log("Lifted the quarantine of bucket ", name)
+	return nil
+}
@@ -0,0 +1,283 @@
+package cleanup
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestAddQuarantineStatement(t *testing.T) {
+	var tests = []struct {
+		policy     string
+		statements int
+	}{
+		{policy: "", statements: 1},
+		{
+			policy:     `{"Version":"2012-10-17","Statement":{"Sid":"A","Effect":"Allow"}}`,
+			statements: 2,
+		},
+		{
+			policy:     `{"Version":"2012-10-17","Statement":[{"Sid":"A"},{"Sid":"B"}]}`,
+			statements: 3,
+		},
+	}
+	for _, test := range tests {
+		result, err := addQuarantineStatement(test.policy, "bucket", "AROA1:session")
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+			continue
+		}
+		policy, err := parseBucketPolicy(result)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+			continue
+		}
+		if len(policy.Statement) != test.statements ||
+			!policy.hasStatement(quarantineSid) {
+			t.Errorf(
+				"Expected %v statements including %v but got %v",
+				test.statements,
+				quarantineSid,
+				result,
+			)
+		}
+	}
+	if _, err := addQuarantineStatement("not json", "bucket", "AROA1:session"); err == nil {
+		t.Errorf("Expected an error for an invalid policy")
+	}
+}
+
+func TestExemptUserID(t *testing.T) {
+	var tests = []struct {
+		userID   string
+		expected string
+	}{
+		{userID: "AROA1EXAMPLE:cleanup-session", expected: "AROA1EXAMPLE:*"},
+		{userID: "AIDA1EXAMPLE", expected: "AIDA1EXAMPLE"},
+	}
+	for _, test := range tests {
+		if result := exemptUserID(test.userID); result != test.expected {
+			t.Errorf("Expected '%v' but got '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestRemoveQuarantineStatement(t *testing.T) {
+	quarantined, err := addQuarantineStatement(
+		`{"Version":"2012-10-17","Statement":{"Sid":"A","Effect":"Allow"}}`,
+		"bucket",
+		"AIDA1EXAMPLE",
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	result, err := removeQuarantineStatement(quarantined)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	policy, err := parseBucketPolicy(result)
+	if err != nil || len(policy.Statement) != 1 || policy.hasStatement(quarantineSid) {
+		t.Errorf("Expected only statement A to be left but got %v", result)
+	}
+
+	quarantined, _ = addQuarantineStatement("", "bucket", "AIDA1EXAMPLE")
+	if result, err := removeQuarantineStatement(quarantined); err != nil || result != "" {
+		t.Errorf("Expected an empty policy but got '%v' and %v", result, err)
+	}
+}
+
+func TestQuarantineBucket(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	bucket := &s3.Bucket{Name: aws.String("teststack1-s3BucketTest")}
+	csbc := &Cleaner{s3SVC: mockS3Iface, callerUserID: "AROA1EXAMPLE:cleanup-session"}
+
+	gomock.InOrder(
+		mockS3Iface.EXPECT().GetBucketPolicyWithContext(
+			gomock.Any(),
+			&s3.GetBucketPolicyInput{Bucket: bucket.Name},
+		).Return(
+			nil,
+			awserr.New(errCodeNoSuchBucketPolicy, "no policy", nil),
+		),
+		mockS3Iface.EXPECT().PutBucketPolicyWithContext(gomock.Any(), gomock.Any()).Do(
+			func(_ aws.Context, input *s3.PutBucketPolicyInput, _ ...request.Option) {
+				var policy map[string]interface{}
+				if err := json.Unmarshal([]byte(*input.Policy), &policy); err != nil {
+					t.Errorf("Expected a JSON policy but got %v", *input.Policy)
+				}
+				if !strings.Contains(*input.Policy, `"aws:userid":"AROA1EXAMPLE:*"`) {
+					t.Errorf("Expected the tool's role to be exempted but got %v", *input.Policy)
+				}
+			},
+		).Return(&s3.PutBucketPolicyOutput{}, nil),
+		mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+			gomock.Any(),
+			&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+		).Return(
+			&s3.GetBucketTaggingOutput{
+				TagSet: []*s3.Tag{
+					&s3.Tag{Key: aws.String("env"), Value: aws.String("dev")},
+				},
+			},
+			nil,
+		),
+		mockS3Iface.EXPECT().PutBucketTaggingWithContext(gomock.Any(), gomock.Any()).Do(
+			func(_ aws.Context, input *s3.PutBucketTaggingInput, _ ...request.Option) {
+				if !hasTag(input.Tagging.TagSet, "env", "dev") ||
+					!hasTag(input.Tagging.TagSet, quarantineTag, "") {
+					t.Errorf("Expected existing and quarantine tags but got %v", input.Tagging.TagSet)
+				}
+			},
+		).Return(&s3.PutBucketTaggingOutput{}, nil),
+	)
+	if quarantined, err := csbc.quarantineBucket(ctx, bucket); err != nil || !quarantined {
+		t.Errorf("Expected the bucket to be quarantined")
+	}
+
+	policy, _ := addQuarantineStatement("", *bucket.Name, "AIDA1EXAMPLE")
+	mockS3Iface.EXPECT().GetBucketPolicyWithContext(
+		gomock.Any(),
+		&s3.GetBucketPolicyInput{Bucket: bucket.Name},
+	).Return(&s3.GetBucketPolicyOutput{Policy: aws.String(policy)}, nil)
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(
+		&s3.GetBucketTaggingOutput{
+			TagSet: []*s3.Tag{
+				&s3.Tag{
+					Key:   aws.String(quarantineTag),
+					Value: aws.String("2016-01-01T00:00:00Z"),
+				},
+			},
+		},
+		nil,
+	)
+	if quarantined, err := csbc.quarantineBucket(ctx, bucket); err != nil || quarantined {
+		t.Errorf("Expected an already quarantined bucket to be left alone")
+	}
+
+	if _, err := (&Cleaner{}).quarantineBucket(ctx, bucket); err == nil {
+		t.Errorf("Expected an error without the caller's user id")
+	}
+}
+
+func TestQuarantineBucketRetriesFailedPolicy(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("teststack1-s3BucketTest")}
+	csbc := &Cleaner{s3SVC: mockS3Iface, callerUserID: "AIDA1EXAMPLE"}
+	mockS3Iface.EXPECT().GetBucketPolicyWithContext(gomock.Any(), gomock.Any()).Return(
+		&s3.GetBucketPolicyOutput{
+			Policy: aws.String(`{"Statement":[{"Sid":"Other","Effect":"Allow"}]}`),
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().PutBucketPolicyWithContext(gomock.Any(), gomock.Any()).Return(
+		nil,
+		awserr.New("AccessDenied", "denied", nil),
+	)
+
+	if _, err := csbc.quarantineBucket(context.Background(), bucket); err == nil {
+		t.Errorf("Expected the policy error without tagging the bucket")
+	}
+}
+
+func TestUnquarantine(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{Name: aws.String("teststack1-s3BucketTest")}
+	csbc := &Cleaner{s3SVC: mockS3Iface, logger: &testLogger{}}
+	policy, _ := addQuarantineStatement("", *bucket.Name, "AIDA1EXAMPLE")
+	mockS3Iface.EXPECT().GetBucketPolicyWithContext(
+		gomock.Any(),
+		&s3.GetBucketPolicyInput{Bucket: bucket.Name},
+	).Return(&s3.GetBucketPolicyOutput{Policy: aws.String(policy)}, nil)
+	mockS3Iface.EXPECT().DeleteBucketPolicyWithContext(
+		gomock.Any(),
+		&s3.DeleteBucketPolicyInput{Bucket: bucket.Name},
+	).Return(&s3.DeleteBucketPolicyOutput{}, nil)
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(
+		&s3.GetBucketTaggingOutput{
+			TagSet: []*s3.Tag{
+				&s3.Tag{Key: aws.String("env"), Value: aws.String("dev")},
+				&s3.Tag{Key: aws.String(quarantineTag), Value: aws.String("2016-01-01T00:00:00Z")},
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().PutBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.PutBucketTaggingInput{
+			Bucket: bucket.Name,
+			Tagging: &s3.Tagging{
+				TagSet: []*s3.Tag{
+					&s3.Tag{Key: aws.String("env"), Value: aws.String("dev")},
+				},
+			},
+		},
+	).Return(&s3.PutBucketTaggingOutput{}, nil)
+
+	if err := csbc.Unquarantine(context.Background(), *bucket.Name); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestRemoveUnusedCFBucketsByAction(t *testing.T) {
+	var tests = []struct {
+		action   Action
+		dryRun   bool
+		expected string
+	}{
+		{action: &reportAction{}, expected: OutcomeReported},
+		{action: &quarantineAction{}, dryRun: true, expected: OutcomeWouldQuarantine},
+	}
+	for _, test := range tests {
+		_, mockS3Iface, ctrl := getMocks(t)
+		expectBucketConfiguration(mockS3Iface)
+
+		bucket := &s3.Bucket{
+			CreationDate: getTimeSecondsBeforeNow(300),
+			Name:         aws.String("team-a-logs"),
+		}
+		csbc := &Cleaner{
+			s3SVC:          mockS3Iface,
+			ruleName:       "team-a",
+			bucketPatterns: []string{"team-a-*"},
+			action:         test.action,
+			dryRun:         test.dryRun,
+		}
+		mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+			&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket}},
+			nil,
+		)
+		mockS3Iface.EXPECT().ListObjectsWithContext(
+			gomock.Any(),
+			&s3.ListObjectsInput{Bucket: bucket.Name},
+		).Return(&s3.ListObjectsOutput{}, nil)
+
+		runRemoval(t, csbc)
+		if len(csbc.report) != 1 || csbc.report[0].Outcome != test.expected {
+			t.Errorf("Expected one '%v' entry but got %v", test.expected, csbc.report)
+		}
+		if entry := csbc.report[0].String(); entry[:8] != "[team-a]" {
+			t.Errorf("Expected the rule name in '%v'", entry)
+		}
+		ctrl.Finish()
+	}
+}
@@ -0,0 +1,236 @@
+package cleanup
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const errCodeValidationError = "ValidationError"
+
+// stackReference is a piece of text a live stack depends on: its template
+// body, a parameter or output value, or the value of an export it imports.
+type stackReference struct {
+	stackName string
+	source    string
+	text      string
+}
+
+func (c *Cleaner) describeStacks(
+	ctx context.Context,
+) ([]*cloudformation.Stack, error) {
+	var (
+		stacks []*cloudformation.Stack
+		token  *string
+	)
+	for {
+		resp, err := c.cfSVC.DescribeStacksWithContext(
+			ctx,
+			&cloudformation.DescribeStacksInput{
+				NextToken: token,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		stacks = append(stacks, resp.Stacks...)
+		if resp.NextToken == nil {
+			return stacks, nil
+		}
+		token = resp.NextToken
+	}
+}
+
+func (c *Cleaner) getTemplateBody(
+	ctx context.Context,
+	stackName *string,
+) (string, error) {
+	resp, err := c.cfSVC.GetTemplateWithContext(
+		ctx,
+		&cloudformation.GetTemplateInput{
+			StackName: stackName,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.TemplateBody), nil
+}
+
+func (c *Cleaner) getExports(
+	ctx context.Context,
+) ([]*cloudformation.Export, error) {
+	var (
+		exports []*cloudformation.Export
+		token   *string
+	)
+	for {
+		resp, err := c.cfSVC.ListExportsWithContext(
+			ctx,
+			&cloudformation.ListExportsInput{
+				NextToken: token,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, resp.Exports...)
+		if resp.NextToken == nil {
+			return exports, nil
+		}
+		token = resp.NextToken
+	}
+}
+
+// getImports lists the stacks importing an export. CloudFormation answers
+// with a ValidationError when nothing imports it.
+func (c *Cleaner) getImports(
+	ctx context.Context,
+	exportName *string,
+) ([]*string, error) {
+	var (
+		imports []*string
+		token   *string
+	)
+	for {
+		resp, err := c.cfSVC.ListImportsWithContext(
+			ctx,
+			&cloudformation.ListImportsInput{
+				ExportName: exportName,
+				NextToken:  token,
+			},
+		)
+		if isAWSErrorCode(err, errCodeValidationError) {
+			return imports, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, resp.Imports...)
+		if resp.NextToken == nil {
+			return imports, nil
+		}
+		token = resp.NextToken
+	}
+}
+
+func collectStackReferences(
+	stack *cloudformation.Stack,
+	template string,
+) []*stackReference {
+	references := []*stackReference{
+		&stackReference{
+			stackName: *stack.StackName,
+			source:    "template",
+			text:      template,
+		},
+	}
+	for _, parameter := range stack.Parameters {
+		references = append(
+			references,
+			&stackReference{
+				stackName: *stack.StackName,
+				source:    "parameter " + aws.StringValue(parameter.ParameterKey),
+				text:      aws.StringValue(parameter.ParameterValue),
+			},
+		)
+	}
+	for _, output := range stack.Outputs {
+		references = append(
+			references,
+			&stackReference{
+				stackName: *stack.StackName,
+				source:    "output " + aws.StringValue(output.OutputKey),
+				text:      aws.StringValue(output.OutputValue),
+			},
+		)
+	}
+	return references
+}
+
+// getStackReferences collects everything live stacks refer to so buckets
+// still consumed by another stack are never deleted.
+func (c *Cleaner) getStackReferences(ctx context.Context) error {
+	c.stackReferences = []*stackReference{}
+	stacks, err := c.describeStacks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, stack := range stacks {
+		template, err := c.getTemplateBody(ctx, stack.StackName)
+		if err != nil {
+			return err
+		}
+		c.stackReferences = append(
+			c.stackReferences,
+			collectStackReferences(stack, template)...,
+		)
+	}
+	exports, err := c.getExports(ctx)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		importers, err := c.getImports(ctx, export.Name)
+		if err != nil {
+			return err
+		}
+		for _, importer := range importers {
+			c.stackReferences = append(
+				c.stackReferences,
+				&stackReference{
+					stackName: *importer,
+					source:    "import of export " + aws.StringValue(export.Name),
+					text:      aws.StringValue(export.Value),
+				},
+			)
+		}
+	}
+	return nil
+}
+
+func isBucketNameChar(b byte) bool {
+	return (b >= 'a' && b <= 'z') ||
+		(b >= '0' && b <= '9') ||
+		b == '-' || b == '.'
+}
+
+// isS3HostSuffix reports whether text, following a bucket name, starts
+// the S3 host of a virtual-hosted or website endpoint URL such as
+// bucket.s3.amazonaws.com or bucket.s3-website-us-east-1.amazonaws.com.
+func isS3HostSuffix(text string) bool {
+	return strings.HasPrefix(text, ".s3.") || strings.HasPrefix(text, ".s3-")
+}
+
+// containsBucketName matches the bucket name as a whole word so that
+// "logs" is not found inside "logs-archive". An S3 host right after the
+// name ends the word too, so URLs like logs.s3.amazonaws.com match.
+func containsBucketName(text string, bucketName string) bool {
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], bucketName)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(bucketName)
+		if (start == 0 || !isBucketNameChar(text[start-1])) &&
+			(end == len(text) || !isBucketNameChar(text[end]) ||
+				isS3HostSuffix(text[end:])) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func (c *Cleaner) referenceReason(bucket *s3.Bucket) string {
+	for _, reference := range c.stackReferences {
+		if containsBucketName(reference.text, *bucket.Name) {
+			return "in use by live stack " + reference.stackName +
+				" (" + reference.source + ")"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestContainsBucketName(t *testing.T) {
+	var tests = []struct {
+		text     string
+		expected bool
+	}{
+		{text: "teststack-logs", expected: true},
+		{text: `{"Bucket": "teststack-logs"}`, expected: true},
+		{text: "arn:aws:s3:::teststack-logs/*", expected: true},
+		{text: "teststack-logs-archive", expected: false},
+		{text: "myteststack-logs teststack-logs", expected: true},
+		{text: "other", expected: false},
+		{text: "https://teststack-logs.s3.amazonaws.com/key", expected: true},
+		{text: "teststack-logs.s3.eu-west-1.amazonaws.com", expected: true},
+		{text: "http://teststack-logs.s3-website-us-east-1.amazonaws.com", expected: true},
+		{text: "teststack-logs.s3-website.eu-west-1.amazonaws.com", expected: true},
+		{text: "s3://teststack-logs/prefix/", expected: true},
+		{text: "s3://teststack-logs", expected: true},
+		{text: "teststack-logs.s3backup", expected: false},
+		{text: "teststack-logs.example.com", expected: false},
+	}
+	for _, test := range tests {
+		result := containsBucketName(test.text, "teststack-logs")
+		if result != test.expected {
+			t.Errorf(
+				"Expected '%v' for %q but got '%v'",
+				test.expected,
+				test.text,
+				result,
+			)
+		}
+	}
+}
+
+func TestGetStackReferences(t *testing.T) {
+	mockCloudformationiface, _, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	mockCloudformationiface.EXPECT().DescribeStacksWithContext(
+		gomock.Any(),
+		&cloudformation.DescribeStacksInput{},
+	).Return(
+		&cloudformation.DescribeStacksOutput{
+			Stacks: []*cloudformation.Stack{
+				&cloudformation.Stack{
+					StackName: aws.String("consumer"),
+					Parameters: []*cloudformation.Parameter{
+						&cloudformation.Parameter{
+							ParameterKey:   aws.String("SourceBucket"),
+							ParameterValue: aws.String("oldstack-source"),
+						},
+					},
+					Outputs: []*cloudformation.Output{
+						&cloudformation.Output{
+							OutputKey:   aws.String("Artifacts"),
+							OutputValue: aws.String("oldstack-artifacts"),
+						},
+					},
+				},
+			},
+		},
+		nil,
+	)
+	mockCloudformationiface.EXPECT().GetTemplateWithContext(
+		gomock.Any(),
+		&cloudformation.GetTemplateInput{StackName: aws.String("consumer")},
+	).Return(
+		&cloudformation.GetTemplateOutput{
+			TemplateBody: aws.String(`{"Resources":{"P":{"Properties":{"Bucket":"oldstack-template"}}}}`),
+		},
+		nil,
+	)
+	mockCloudformationiface.EXPECT().ListExportsWithContext(
+		gomock.Any(),
+		&cloudformation.ListExportsInput{},
+	).Return(
+		&cloudformation.ListExportsOutput{
+			Exports: []*cloudformation.Export{
+				&cloudformation.Export{
+					Name:  aws.String("SharedBucket"),
+					Value: aws.String("oldstack-exported"),
+				},
+				&cloudformation.Export{
+					Name:  aws.String("UnusedBucket"),
+					Value: aws.String("oldstack-unused"),
+				},
+			},
+		},
+		nil,
+	)
+	mockCloudformationiface.EXPECT().ListImportsWithContext(
+		gomock.Any(),
+		&cloudformation.ListImportsInput{ExportName: aws.String("SharedBucket")},
+	).Return(
+		&cloudformation.ListImportsOutput{
+			Imports: []*string{aws.String("importer")},
+		},
+		nil,
+	)
+	mockCloudformationiface.EXPECT().ListImportsWithContext(
+		gomock.Any(),
+		&cloudformation.ListImportsInput{ExportName: aws.String("UnusedBucket")},
+	).Return(nil, awserr.New(errCodeValidationError, "not imported", nil))
+
+	csbc := &Cleaner{cfSVC: mockCloudformationiface}
+	if err := csbc.getStackReferences(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var tests = []struct {
+		bucket string
+		inUse  bool
+	}{
+		{bucket: "oldstack-source", inUse: true},
+		{bucket: "oldstack-artifacts", inUse: true},
+		{bucket: "oldstack-template", inUse: true},
+		{bucket: "oldstack-exported", inUse: true},
+		{bucket: "oldstack-unused", inUse: false},
+		{bucket: "oldstack", inUse: false},
+	}
+	for _, test := range tests {
+		reason := csbc.referenceReason(&s3.Bucket{Name: aws.String(test.bucket)})
+		if (reason != "") != test.inUse {
+			t.Errorf(
+				"Expected %v in use '%v' but got reason '%v'",
+				test.bucket,
+				test.inUse,
+				reason,
+			)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package cleanup
+
+import (
+	"context"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// normalizeLocation maps GetBucketLocation's legacy answers to region
+// names: no constraint means us-east-1 and EU means eu-west-1.
+func normalizeLocation(location string) string {
+	switch location {
+	case "":
+		return "us-east-1"
+	case "EU":
+		return "eu-west-1"
+	}
+	return location
+}
+
+func (c *Cleaner) getBucketRegion(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (string, error) {
+	resp, err := c.s3SVC.GetBucketLocationWithContext(
+		ctx,
+		&s3.GetBucketLocationInput{
+			Bucket: bucket.Name,
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	return normalizeLocation(aws.StringValue(resp.LocationConstraint)), nil
+}
+
+func matchesBucketPatterns(bucketName string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, bucketName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesBucketFilter applies the rule's bucket patterns, or the
+// --bucket-filter substring without a rule.
+func (c *Cleaner) matchesBucketFilter(bucketName string) bool {
+	if len(c.bucketPatterns) > 0 {
+		return matchesBucketPatterns(bucketName, c.bucketPatterns)
+	}
+	return isCloudformationBucket(bucketName, c.bucketFilter)
+}
+
+// isCandidateBucket applies matchesBucketFilter and the rule's region.
+func (c *Cleaner) isCandidateBucket(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (bool, error) {
+	if !c.matchesBucketFilter(*bucket.Name) {
+		return false, nil
+	}
+	if c.bucketRegion == "" {
+		return true, nil
+	}
+	region, err := c.getBucketRegion(ctx, bucket)
+	return region == c.bucketRegion, err
+}
@@ -0,0 +1,76 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestNormalizeLocation(t *testing.T) {
+	var tests = []struct {
+		location string
+		expected string
+	}{
+		{location: "", expected: "us-east-1"},
+		{location: "EU", expected: "eu-west-1"},
+		{location: "ap-southeast-2", expected: "ap-southeast-2"},
+	}
+	for _, test := range tests {
+		result := normalizeLocation(test.location)
+		if result != test.expected {
+			t.Errorf("Expected output of '%v' but got '%v'", test.expected, result)
+		}
+	}
+}
+
+func TestIsCandidateBucket(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	var tests = []struct {
+		bucket   string
+		patterns []string
+		region   string
+		location string
+		expected bool
+	}{
+		{bucket: "stack-exhibitors3bucket-1", expected: true},
+		{bucket: "team-a-logs", expected: false},
+		{bucket: "team-a-logs", patterns: []string{"team-b-*", "team-a-*"}, expected: true},
+		{bucket: "stack-exhibitors3bucket-1", patterns: []string{"team-a-*"}, expected: false},
+		{bucket: "team-a-eu", patterns: []string{"team-a-*"}, region: "eu-west-1", location: "EU", expected: true},
+		{bucket: "team-a-us", patterns: []string{"team-a-*"}, region: "eu-west-1", location: "", expected: false},
+	}
+	for _, test := range tests {
+		bucket := &s3.Bucket{Name: aws.String(test.bucket)}
+		csbc := &Cleaner{
+			s3SVC:          mockS3Iface,
+			bucketFilter:   "exhibitors3bucket",
+			bucketPatterns: test.patterns,
+			bucketRegion:   test.region,
+		}
+		if test.region != "" {
+			mockS3Iface.EXPECT().GetBucketLocationWithContext(
+				gomock.Any(),
+				&s3.GetBucketLocationInput{Bucket: bucket.Name},
+			).Return(
+				&s3.GetBucketLocationOutput{
+					LocationConstraint: aws.String(test.location),
+				},
+				nil,
+			)
+		}
+		result, err := csbc.isCandidateBucket(context.Background(), bucket)
+		if err != nil || result != test.expected {
+			t.Errorf(
+				"%v: expected output of '%v' but got '%v'",
+				test.bucket,
+				test.expected,
+				result,
+			)
+		}
+	}
+}
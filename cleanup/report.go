@@ -0,0 +1,85 @@
+package cleanup
+
+import (
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Outcomes recorded in a ReportEntry.
+const (
+	OutcomeDeleted = "deleted"
+	OutcomeSkipped = "skipped"
+	OutcomeFailed  = "failed"
+	OutcomeKept    = "kept"
+	OutcomePruned  = "pruned"
+
+	// OutcomeUndeletable is a bucket Object Lock keeps from being emptied.
+	OutcomeUndeletable = "undeletable by policy"
+
+	OutcomeReported    = "reported"
+	OutcomeTagged      = "tagged"
+	OutcomeQuarantined = "quarantined"
+	OutcomeExpiring    = "expiring"
+	OutcomePending     = "pending"
+	OutcomeManifest    = "manifest written"
+
+	OutcomeWouldDelete = "would be deleted"
+	OutcomeReady       = "ready"
+	OutcomeWouldFail   = "would fail"
+	OutcomeWouldPrune  = "would be pruned"
+
+	OutcomeWouldTag        = "would be tagged"
+	OutcomeWouldQuarantine = "would be quarantined"
+	OutcomeWouldExpire     = "would be expired"
+	OutcomeWouldManifest   = "would write manifest"
+)
+
+// ReportEntry records what happened, or would happen, to one bucket.
+type ReportEntry struct {
+	// Rule is the name of the config rule the run belonged to, if any.
+	Rule    string
+	Bucket  string
+	Outcome string
+	// Reason explains the outcome, such as why a bucket was kept.
+	Reason string
+}
+
+func (c *Cleaner) recordBucket(
+	bucket *s3.Bucket,
+	outcome string,
+	reason string,
+) {
+	c.report = append(
+		c.report,
+		&ReportEntry{
+			Rule:    c.ruleName,
+			Bucket:  *bucket.Name,
+			Outcome: outcome,
+			Reason:  reason,
+		},
+	)
+}
+
+// recordPlan reports a plan without acting on it, for dry runs.
+func (c *Cleaner) recordPlan(plan []*PlannedBucket, outcome string) {
+	for _, planned := range plan {
+		c.recordBucket(planned.Bucket, outcome, planSummary(planned))
+	}
+}
+
+func (e *ReportEntry) String() string {
+	result := e.Bucket + ": " + e.Outcome
+	if e.Reason != "" {
+		result += " (" + e.Reason + ")"
+	}
+	if e.Rule != "" {
+		result = "[" + e.Rule + "] " + result
+	}
+	return result
+}
+
+// takeReport returns the entries recorded so far and starts a new report.
+func (c *Cleaner) takeReport() []*ReportEntry {
+	report := c.report
+	c.report = nil
+	return report
+}
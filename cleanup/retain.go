@@ -0,0 +1,120 @@
+package cleanup
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const s3BucketResourceType = "AWS::S3::Bucket"
+
+func (c *Cleaner) getDeletedStacks(
+	ctx context.Context,
+) ([]*cloudformation.StackSummary, error) {
+	var (
+		stacks []*cloudformation.StackSummary
+		token  *string
+	)
+	for {
+		resp, err := c.cfSVC.ListStacksWithContext(
+			ctx,
+			&cloudformation.ListStacksInput{
+				NextToken: token,
+				StackStatusFilter: []*string{
+					aws.String(cloudformation.StackStatusDeleteComplete),
+				},
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		stacks = append(stacks, resp.StackSummaries...)
+		if resp.NextToken == nil {
+			return stacks, nil
+		}
+		token = resp.NextToken
+	}
+}
+
+// loadDeletedStacks returns the deleted stacks, listing them once per
+// plan.
+func (c *Cleaner) loadDeletedStacks(
+	ctx context.Context,
+) ([]*cloudformation.StackSummary, error) {
+	if c.deletedStacks != nil {
+		return c.deletedStacks, nil
+	}
+	stacks, err := c.getDeletedStacks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.deletedStacks = append([]*cloudformation.StackSummary{}, stacks...)
+	return c.deletedStacks, nil
+}
+
+func (c *Cleaner) getStackResources(
+	ctx context.Context,
+	stackID *string,
+) ([]*cloudformation.StackResourceSummary, error) {
+	var (
+		resources []*cloudformation.StackResourceSummary
+		token     *string
+	)
+	for {
+		resp, err := c.cfSVC.ListStackResourcesWithContext(
+			ctx,
+			&cloudformation.ListStackResourcesInput{
+				NextToken: token,
+				StackName: stackID,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resp.StackResourceSummaries...)
+		if resp.NextToken == nil {
+			return resources, nil
+		}
+		token = resp.NextToken
+	}
+}
+
+func isRetainedBucket(resource *cloudformation.StackResourceSummary) bool {
+	return aws.StringValue(resource.ResourceType) == s3BucketResourceType &&
+		aws.StringValue(resource.ResourceStatus) ==
+			cloudformation.ResourceStatusDeleteSkipped &&
+		resource.PhysicalResourceId != nil
+}
+
+// getRetainedBuckets records every bucket CloudFormation skipped while
+// deleting a stack, which is what DeletionPolicy: Retain produces. Deleted
+// stacks have to be addressed by stack ID rather than by name.
+func (c *Cleaner) getRetainedBuckets(ctx context.Context) error {
+	c.retainedBuckets = map[string]string{}
+	stacks, err := c.loadDeletedStacks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, stack := range stacks {
+		resources, err := c.getStackResources(ctx, stack.StackId)
+		if err != nil {
+			return err
+		}
+		for _, resource := range resources {
+			if isRetainedBucket(resource) {
+				c.retainedBuckets[*resource.PhysicalResourceId] = *stack.StackName
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Cleaner) retainReason(bucket *s3.Bucket) string {
+	stackName, ok := c.retainedBuckets[*bucket.Name]
+	if !ok {
+		return ""
+	}
+	return "retained by deleted stack " + stackName + " (DeletionPolicy: Retain)"
+}
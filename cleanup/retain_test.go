@@ -0,0 +1,118 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestGetRetainedBuckets(t *testing.T) {
+	mockCloudformationiface, _, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	deleteComplete := []*string{
+		aws.String(cloudformation.StackStatusDeleteComplete),
+	}
+	gomock.InOrder(
+		mockCloudformationiface.EXPECT().ListStacksWithContext(
+			gomock.Any(),
+			&cloudformation.ListStacksInput{StackStatusFilter: deleteComplete},
+		).Return(
+			&cloudformation.ListStacksOutput{
+				NextToken: aws.String("page2"),
+				StackSummaries: []*cloudformation.StackSummary{
+					&cloudformation.StackSummary{
+						StackName: aws.String("teststack1"),
+						StackId:   aws.String("arn:teststack1"),
+					},
+				},
+			},
+			nil,
+		),
+		mockCloudformationiface.EXPECT().ListStacksWithContext(
+			gomock.Any(),
+			&cloudformation.ListStacksInput{
+				NextToken:         aws.String("page2"),
+				StackStatusFilter: deleteComplete,
+			},
+		).Return(
+			&cloudformation.ListStacksOutput{
+				StackSummaries: []*cloudformation.StackSummary{
+					&cloudformation.StackSummary{
+						StackName: aws.String("teststack2"),
+						StackId:   aws.String("arn:teststack2"),
+					},
+				},
+			},
+			nil,
+		),
+	)
+	mockCloudformationiface.EXPECT().ListStackResourcesWithContext(
+		gomock.Any(),
+		&cloudformation.ListStackResourcesInput{
+			StackName: aws.String("arn:teststack1"),
+		},
+	).Return(
+		&cloudformation.ListStackResourcesOutput{
+			StackResourceSummaries: []*cloudformation.StackResourceSummary{
+				&cloudformation.StackResourceSummary{
+					PhysicalResourceId: aws.String("teststack1-retained"),
+					ResourceStatus: aws.String(
+						cloudformation.ResourceStatusDeleteSkipped,
+					),
+					ResourceType: aws.String(s3BucketResourceType),
+				},
+				&cloudformation.StackResourceSummary{
+					PhysicalResourceId: aws.String("teststack1-deleted"),
+					ResourceStatus: aws.String(
+						cloudformation.ResourceStatusDeleteComplete,
+					),
+					ResourceType: aws.String(s3BucketResourceType),
+				},
+				&cloudformation.StackResourceSummary{
+					PhysicalResourceId: aws.String("teststack1-queue"),
+					ResourceStatus: aws.String(
+						cloudformation.ResourceStatusDeleteSkipped,
+					),
+					ResourceType: aws.String("AWS::SQS::Queue"),
+				},
+			},
+		},
+		nil,
+	)
+	mockCloudformationiface.EXPECT().ListStackResourcesWithContext(
+		gomock.Any(),
+		&cloudformation.ListStackResourcesInput{
+			StackName: aws.String("arn:teststack2"),
+		},
+	).Return(&cloudformation.ListStackResourcesOutput{}, nil)
+
+	csbc := &Cleaner{cfSVC: mockCloudformationiface}
+	if err := csbc.getRetainedBuckets(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	var tests = []struct {
+		bucket   *s3.Bucket
+		retained bool
+	}{
+		{bucket: &s3.Bucket{Name: aws.String("teststack1-retained")}, retained: true},
+		{bucket: &s3.Bucket{Name: aws.String("teststack1-deleted")}, retained: false},
+		{bucket: &s3.Bucket{Name: aws.String("teststack1-queue")}, retained: false},
+	}
+	for _, test := range tests {
+		result := csbc.retainReason(test.bucket) != ""
+		if result != test.retained {
+			t.Errorf(
+				"Expected %v to be retained '%v' but got '%v'",
+				*test.bucket.Name,
+				test.retained,
+				result,
+			)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// bucketClass describes a family of well-known buckets shared by many
+// stacks. They are protected from deletion and can only be pruned.
+type bucketClass struct {
+	name    string
+	pattern *regexp.Regexp
+	// staleObjects picks the objects prune mode may delete. Classes without
+	// one are protected but never pruned.
+	staleObjects func(c *Cleaner, objects []*s3.Object) []*s3.Object
+}
+
+var bucketClasses = []*bucketClass{
+	&bucketClass{
+		name: "CDK bootstrap assets",
+		pattern: regexp.MustCompile(
+			`^cdk-[a-z0-9]+-assets-[0-9]{12}-[a-z0-9-]+$`,
+		),
+		staleObjects: cdkStaleAssets,
+	},
+	&bucketClass{
+		name:         "SAM CLI managed",
+		pattern:      regexp.MustCompile(`^aws-sam-cli-managed-default-`),
+		staleObjects: unreferencedObjects,
+	},
+	&bucketClass{
+		name: "CloudFormation template uploads",
+		pattern: regexp.MustCompile(
+			`^cf-templates-[a-z0-9]+-[a-z]{2}(-gov)?-[a-z]+-[0-9]$`,
+		),
+		staleObjects: staleTemplateUploads,
+	},
+}
+
+// sharedBucketRegionPattern finds the region CDK and CloudFormation end
+// their shared bucket names with.
+var sharedBucketRegionPattern = regexp.MustCompile(`-([a-z]{2}(-gov)?-[a-z]+-[0-9])$`)
+
+func classifyBucket(bucketName string) *bucketClass {
+	for _, class := range bucketClasses {
+		if class.pattern.MatchString(bucketName) {
+			return class
+		}
+	}
+	return nil
+}
+
+func (c *Cleaner) sharedBucketReason(bucket *s3.Bucket) string {
+	class := classifyBucket(*bucket.Name)
+	if class == nil || c.deleteSharedBuckets {
+		return ""
+	}
+	return "shared " + class.name + " bucket"
+}
+
+func (c *Cleaner) isReferencedByTemplate(text string) bool {
+	for _, reference := range c.stackReferences {
+		if reference.source == "template" &&
+			strings.Contains(reference.text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cleaner) isPruneCandidate(object *s3.Object) bool {
+	return object.LastModified != nil &&
+		time.Since(*object.LastModified) >= c.pruneMinAge
+}
+
+// unreferencedObjects returns the old objects whose key no live stack
+// template mentions.
+func unreferencedObjects(
+	c *Cleaner,
+	objects []*s3.Object,
+) []*s3.Object {
+	var stale []*s3.Object
+	for _, object := range objects {
+		if c.isPruneCandidate(object) &&
+			!c.isReferencedByTemplate(*object.Key) {
+			stale = append(stale, object)
+		}
+	}
+	return stale
+}
+
+// isPruneRegion reports whether the shared bucket is in the run's region,
+// read from its name when it ends with one.
+func (c *Cleaner) isPruneRegion(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (bool, error) {
+	if c.region == "" {
+		return true, nil
+	}
+	if match := sharedBucketRegionPattern.FindStringSubmatch(*bucket.Name); match != nil {
+		return match[1] == c.region, nil
+	}
+	region, err := c.getBucketRegion(ctx, bucket)
+	return region == c.region, err
+}
+
+func (c *Cleaner) planSharedPrune(ctx context.Context) ([]*PlannedBucket, error) {
+	var plan []*PlannedBucket
+	buckets, err := c.listBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range buckets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		class := classifyBucket(*bucket.Name)
+		if class == nil || !c.matchesBucketFilter(*bucket.Name) {
+			continue
+		}
+		inRegion, err := c.isPruneRegion(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+		if !inRegion {
+			continue
+		}
+		if class.staleObjects == nil {
+			c.skipBucket(bucket, "pruning "+class.name+" buckets is not supported")
+			continue
+		}
+		reason, err := c.protectionReason(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			c.skipBucket(bucket, reason)
+			continue
+		}
+		objects, err := c.getBucketContents(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+		stale := class.staleObjects(c, objects)
+		if isBucketEmpty(stale) {
+			c.recordBucket(bucket, OutcomeKept, "no stale objects")
+			continue
+		}
+		plan = append(plan, &PlannedBucket{Bucket: bucket, Objects: stale})
+	}
+	return plan, nil
+}
+
+// pruneBuckets deletes stale objects from shared buckets while leaving
+// the buckets themselves in place.
+func (c *Cleaner) pruneBuckets(
+	ctx context.Context,
+	plan []*PlannedBucket,
+) ([]*s3.Error, error) {
+	errors := []*s3.Error{}
+	if err := c.enforceLimits(plan); err != nil {
+		return errors, err
+	}
+	if c.dryRun {
+		c.recordPlan(plan, OutcomeWouldPrune)
+		return errors, nil
+	}
+	for _, planned := range plan {
+		if err := ctx.Err(); err != nil {
+			return errors, err
+		}
+		c.log(
+			"Pruning ", len(planned.Objects), " objects from ", *planned.Bucket.Name,
+		)
+		errs, err := c.emptyBucket(ctx, planned.Bucket, planned.Objects)
+		errors = append(errors, errs...)
+		if err != nil {
+			c.recordBucket(planned.Bucket, OutcomeFailed, err.Error())
+			return errors, err
+		}
+		if len(errs) > 0 {
+			c.recordBucket(planned.Bucket, OutcomeFailed, "could not prune objects")
+			continue
+		}
+		c.recordBucket(
+			planned.Bucket,
+			OutcomePruned,
+			fmt.Sprintf("%d stale objects", len(planned.Objects)),
+		)
+	}
+	return errors, nil
+}
@@ -0,0 +1,223 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestClassifyBucket(t *testing.T) {
+	var tests = []struct {
+		bucketName string
+		class      *bucketClass
+	}{
+		{bucketName: "cdk-hnb659fds-assets-123456789012-us-east-1", class: bucketClasses[0]},
+		{bucketName: "aws-sam-cli-managed-default-samclisourcebucket-1a2b3c4d", class: bucketClasses[1]},
+		{bucketName: "cf-templates-1a2b3c4d5e6f-us-east-1", class: bucketClasses[2]},
+		{bucketName: "cf-templates-1a2b3c4d5e6f-us-gov-west-1", class: bucketClasses[2]},
+		{bucketName: "teststack1-exhibitors3bucket-1a2b3c", class: nil},
+	}
+	for _, test := range tests {
+		if result := classifyBucket(test.bucketName); result != test.class {
+			t.Errorf("Unexpected class %v for %v", result, test.bucketName)
+		}
+	}
+}
+
+func TestSharedBucketReason(t *testing.T) {
+	bucket := &s3.Bucket{
+		Name: aws.String("cdk-hnb659fds-assets-123456789012-us-east-1"),
+	}
+	if reason := (&Cleaner{}).sharedBucketReason(bucket); reason == "" {
+		t.Errorf("Expected the CDK bucket to be protected")
+	}
+	csbc := &Cleaner{deleteSharedBuckets: true}
+	if reason := csbc.sharedBucketReason(bucket); reason != "" {
+		t.Errorf("Expected no protection but got '%v'", reason)
+	}
+}
+
+func TestPruneSharedBuckets(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	samBucket := &s3.Bucket{
+		Name: aws.String("aws-sam-cli-managed-default-samclisourcebucket-1a2b3c4d"),
+	}
+	csbc := &Cleaner{
+		s3SVC:       mockS3Iface,
+		pruneMinAge: 30 * day,
+		stackReferences: []*stackReference{
+			&stackReference{
+				stackName: "app",
+				source:    "template",
+				text:      `{"CodeUri":"s3://bucket/app/0123abcd"}`,
+			},
+		},
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{samBucket}},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: samBucket.Name},
+	).Return(
+		&s3.ListObjectsOutput{
+			Contents: []*s3.Object{
+				&s3.Object{
+					Key:          aws.String("app/0123abcd"),
+					LastModified: getTimeSecondsBeforeNow(90 * 86400),
+				},
+				&s3.Object{
+					Key:          aws.String("app/4567efab"),
+					LastModified: getTimeSecondsBeforeNow(90 * 86400),
+				},
+				&s3.Object{
+					Key:          aws.String("app/89abcdef"),
+					LastModified: getTimeSecondsBeforeNow(86400),
+				},
+			},
+		},
+		nil,
+	)
+	mockS3Iface.EXPECT().DeleteObjectsWithContext(
+		gomock.Any(),
+		&s3.DeleteObjectsInput{
+			Bucket: samBucket.Name,
+			Delete: &s3.Delete{
+				Objects: []*s3.ObjectIdentifier{
+					&s3.ObjectIdentifier{Key: aws.String("app/4567efab")},
+				},
+			},
+		},
+	).Return(&s3.DeleteObjectsOutput{}, nil)
+
+	errs := runPrune(t, csbc)
+	if len(errs) > 0 {
+		t.Errorf("Expected 0 errors but got %v", len(errs))
+	}
+	if len(csbc.report) != 1 || csbc.report[0].Outcome != OutcomePruned {
+		t.Errorf("Unexpected report %v", csbc.report)
+	}
+}
+
+func TestPruneSharedBucketsDryRun(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{
+		Name: aws.String("aws-sam-cli-managed-default-samclisourcebucket-1a2b3c4d"),
+	}
+	csbc := &Cleaner{
+		s3SVC:       mockS3Iface,
+		pruneMinAge: 30 * day,
+		dryRun:      true,
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket}},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: bucket.Name},
+	).Return(
+		&s3.ListObjectsOutput{
+			Contents: []*s3.Object{
+				&s3.Object{
+					Key:          aws.String("app/4567efab"),
+					LastModified: getTimeSecondsBeforeNow(90 * 86400),
+				},
+			},
+		},
+		nil,
+	)
+
+	runPrune(t, csbc)
+	if len(csbc.report) != 1 || csbc.report[0].Outcome != OutcomeWouldPrune {
+		t.Errorf("Unexpected report %v", csbc.report)
+	}
+}
+
+func TestPlanSharedPruneSkipsProtectedBuckets(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	bucket := &s3.Bucket{
+		Name: aws.String("aws-sam-cli-managed-default-samclisourcebucket-1a2b3c4d"),
+	}
+	csbc := &Cleaner{
+		s3SVC:           mockS3Iface,
+		pruneMinAge:     30 * day,
+		protectTagKey:   "cleanup:protect",
+		protectTagValue: "true",
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket}},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+		gomock.Any(),
+		&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+	).Return(
+		&s3.GetBucketTaggingOutput{
+			TagSet: []*s3.Tag{
+				&s3.Tag{Key: aws.String("cleanup:protect"), Value: aws.String("true")},
+			},
+		},
+		nil,
+	)
+
+	plan, err := csbc.planSharedPrune(context.Background())
+	if err != nil || len(plan) != 0 {
+		t.Errorf("Expected an empty plan but got %v and %v", plan, err)
+	}
+	if len(csbc.report) != 1 || csbc.report[0].Outcome != OutcomeSkipped {
+		t.Errorf("Expected the protected bucket to be skipped but got %v", csbc.report)
+	}
+}
+
+func TestPlanSharedPruneInRunRegion(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	local := &s3.Bucket{Name: aws.String("cf-templates-1a2b3c4d-us-east-1")}
+	remote := &s3.Bucket{Name: aws.String("cf-templates-1a2b3c4d-eu-west-1")}
+	sam := &s3.Bucket{
+		Name: aws.String("aws-sam-cli-managed-default-samclisourcebucket-1a2b3c4d"),
+	}
+	cdk := &s3.Bucket{
+		Name: aws.String("cdk-hnb659fds-assets-123456789012-us-east-1"),
+	}
+	csbc := &Cleaner{
+		s3SVC:        mockS3Iface,
+		region:       "us-east-1",
+		bucketFilter: "-1a2b3c4d",
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{local, remote, sam, cdk}},
+		nil,
+	)
+	mockS3Iface.EXPECT().GetBucketLocationWithContext(
+		gomock.Any(),
+		&s3.GetBucketLocationInput{Bucket: sam.Name},
+	).Return(
+		&s3.GetBucketLocationOutput{LocationConstraint: aws.String("eu-west-1")},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: local.Name},
+	).Return(&s3.ListObjectsOutput{}, nil)
+
+	plan, err := csbc.planSharedPrune(context.Background())
+	if err != nil || len(plan) != 0 {
+		t.Errorf("Expected an empty plan but got %v and %v", plan, err)
+	}
+	if len(csbc.report) != 1 || csbc.report[0].Bucket != *local.Name {
+		t.Errorf("Expected only %v to be considered but got %v", *local.Name, csbc.report)
+	}
+}
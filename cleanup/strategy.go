@@ -0,0 +1,488 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Verdict is an ownership strategy's answer for one bucket.
+type Verdict int
+
+// A bucket is only removed when the strategy finds it orphaned; an
+// unknown verdict keeps it.
+const (
+	VerdictUnknown Verdict = iota
+	VerdictOwned
+	VerdictOrphaned
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case VerdictOwned:
+		return "owned"
+	case VerdictOrphaned:
+		return "orphaned"
+	}
+	return "unknown"
+}
+
+// OwnershipDecision is a verdict with the evidence behind it.
+type OwnershipDecision struct {
+	Verdict Verdict
+	// Stack is the live stack that owns the bucket, or the closest match.
+	Stack    *cloudformation.StackSummary
+	Evidence []string
+}
+
+// OwnershipStrategy decides whether a live stack owns a bucket. Decide is
+// called before the bucket is listed and again once StackInventory.Objects
+// knows its contents. An error aborts the run.
+type OwnershipStrategy interface {
+	Name() string
+	Decide(
+		ctx context.Context,
+		bucket *s3.Bucket,
+		inventory *StackInventory,
+	) (*OwnershipDecision, error)
+}
+
+// StackInventory is what a run discovered about the live stacks, as seen
+// by ownership strategies.
+type StackInventory struct {
+	c       *Cleaner
+	tags    map[string][]*s3.Tag
+	objects map[string][]*s3.Object
+}
+
+// Stacks returns the live stacks.
+func (inv *StackInventory) Stacks() []*cloudformation.StackSummary {
+	return inv.c.stacks
+}
+
+// StackForBucket returns the live stack declaring the bucket as a
+// resource, or nil.
+func (inv *StackInventory) StackForBucket(
+	bucket *s3.Bucket,
+) *cloudformation.StackSummary {
+	return inv.c.stackBuckets[*bucket.Name]
+}
+
+// FindStack returns the live stack with the given ID, or nil.
+func (inv *StackInventory) FindStack(stackID string) *cloudformation.StackSummary {
+	return inv.c.findStackByID(stackID)
+}
+
+// NearestStack returns the live stack whose name appears in the bucket
+// name and whose creation time is closest to the bucket's, or nil.
+func (inv *StackInventory) NearestStack(
+	bucket *s3.Bucket,
+) *cloudformation.StackSummary {
+	return inv.c.nearestStack(bucket)
+}
+
+// MatchCreationTime reports whether the bucket was created within the
+// creation window of the stack, with a description of the comparison.
+func (inv *StackInventory) MatchCreationTime(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	stack *cloudformation.StackSummary,
+) (bool, string, error) {
+	return inv.c.matchCreationTime(ctx, bucket, stack)
+}
+
+// BucketTags returns the bucket's tags, fetched once per run.
+func (inv *StackInventory) BucketTags(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) ([]*s3.Tag, error) {
+	if tags, ok := inv.tags[*bucket.Name]; ok {
+		return tags, nil
+	}
+	tags, err := inv.c.getBucketTags(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	inv.tags[*bucket.Name] = tags
+	return tags, nil
+}
+
+// Objects returns the bucket's objects once they have been listed.
+func (inv *StackInventory) Objects(bucket *s3.Bucket) ([]*s3.Object, bool) {
+	objects, ok := inv.objects[*bucket.Name]
+	return objects, ok
+}
+
+func (c *Cleaner) stackInventory() *StackInventory {
+	if c.inventory == nil {
+		c.inventory = &StackInventory{
+			c:       c,
+			tags:    map[string][]*s3.Tag{},
+			objects: map[string][]*s3.Object{},
+		}
+	}
+	return c.inventory
+}
+
+func (c *Cleaner) ownershipStrategy() OwnershipStrategy {
+	if c.strategy == nil {
+		return &scoreStrategy{}
+	}
+	return c.strategy
+}
+
+func (c *Cleaner) decideOwnership(
+	ctx context.Context,
+	bucket *s3.Bucket,
+) (*OwnershipDecision, error) {
+	return c.ownershipStrategy().Decide(ctx, bucket, c.stackInventory())
+}
+
+// decideListedOwnership decides again once the bucket has been listed.
+func (c *Cleaner) decideListedOwnership(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	objects []*s3.Object,
+) (*OwnershipDecision, error) {
+	c.stackInventory().objects[*bucket.Name] = objects
+	return c.decideOwnership(ctx, bucket)
+}
+
+func (c *Cleaner) describeDecision(decision *OwnershipDecision) string {
+	description := decision.Verdict.String()
+	if decision.Stack != nil && decision.Verdict == VerdictOwned {
+		description += " by " + c.describeStack(decision.Stack)
+	}
+	return description + " (" + c.ownershipStrategy().Name() + ")"
+}
+
+// scoreStrategy combines every ownership signal into a score compared
+// with the ownership threshold.
+type scoreStrategy struct{}
+
+func (s *scoreStrategy) Name() string {
+	return OwnershipStrategyScore
+}
+
+func (s *scoreStrategy) Decide(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	inventory *StackInventory,
+) (*OwnershipDecision, error) {
+	c := inventory.c
+	score, err := c.scoreOwnership(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if objects, ok := inventory.Objects(bucket); ok {
+		scoreActivity(score, objects)
+	}
+	decision := &OwnershipDecision{Verdict: VerdictOrphaned, Stack: score.owner}
+	if c.isOwned(score) {
+		decision.Verdict = VerdictOwned
+	}
+	for _, signal := range score.signals {
+		decision.Evidence = append(
+			decision.Evidence,
+			fmt.Sprintf(
+				"%-20s %+4d  %s",
+				signal.name,
+				signal.contribution,
+				signal.evidence,
+			),
+		)
+	}
+	decision.Evidence = append(
+		decision.Evidence,
+		fmt.Sprintf("Score: %d (threshold %d)", score.total(), c.threshold()),
+	)
+	return decision, nil
+}
+
+// nameAndDateStrategy is the original heuristic: a bucket is owned when
+// its name contains a live stack name and it was created within the
+// creation window of that stack.
+type nameAndDateStrategy struct{}
+
+func (s *nameAndDateStrategy) Name() string {
+	return OwnershipStrategyNameAndDate
+}
+
+func (s *nameAndDateStrategy) Decide(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	inventory *StackInventory,
+) (*OwnershipDecision, error) {
+	stack := inventory.NearestStack(bucket)
+	if stack == nil {
+		return &OwnershipDecision{
+			Verdict:  VerdictOrphaned,
+			Evidence: []string{"no live stack name in bucket name"},
+		}, nil
+	}
+	matched, evidence, err := inventory.MatchCreationTime(ctx, bucket, stack)
+	if err != nil {
+		return nil, err
+	}
+	decision := &OwnershipDecision{
+		Verdict: VerdictOrphaned,
+		Stack:   stack,
+		Evidence: []string{
+			"contains stack name " + *stack.StackName,
+			evidence,
+		},
+	}
+	if matched {
+		decision.Verdict = VerdictOwned
+	}
+	return decision, nil
+}
+
+// stackResourceStrategy owns the buckets live stacks declare as resources
+// and has no opinion on the others.
+type stackResourceStrategy struct{}
+
+func (s *stackResourceStrategy) Name() string {
+	return OwnershipStrategyStackResource
+}
+
+func (s *stackResourceStrategy) Decide(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	inventory *StackInventory,
+) (*OwnershipDecision, error) {
+	stack := inventory.StackForBucket(bucket)
+	if stack == nil {
+		return &OwnershipDecision{
+			Verdict:  VerdictUnknown,
+			Evidence: []string{"not a resource of a live stack"},
+		}, nil
+	}
+	return &OwnershipDecision{
+		Verdict:  VerdictOwned,
+		Stack:    stack,
+		Evidence: []string{"resource of live stack " + *stack.StackName},
+	}, nil
+}
+
+// stackTagStrategy follows the aws:cloudformation:stack-id tag: a live
+// stack owns the bucket, a deleted one orphans it.
+type stackTagStrategy struct{}
+
+func (s *stackTagStrategy) Name() string {
+	return OwnershipStrategyStackTag
+}
+
+func (s *stackTagStrategy) Decide(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	inventory *StackInventory,
+) (*OwnershipDecision, error) {
+	tags, err := inventory.BucketTags(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) != stackIDTag {
+			continue
+		}
+		stackID := aws.StringValue(tag.Value)
+		if stack := inventory.FindStack(stackID); stack != nil {
+			return &OwnershipDecision{
+				Verdict:  VerdictOwned,
+				Stack:    stack,
+				Evidence: []string{"tagged with live stack " + *stack.StackName},
+			}, nil
+		}
+		return &OwnershipDecision{
+			Verdict:  VerdictOrphaned,
+			Evidence: []string{"tagged with stack " + stackID + " which is not live"},
+		}, nil
+	}
+	return &OwnershipDecision{
+		Verdict:  VerdictUnknown,
+		Evidence: []string{"no " + stackIDTag + " tag"},
+	}, nil
+}
+
+// compositeStrategy combines the verdicts of several strategies.
+type compositeStrategy struct {
+	name       string
+	strategies []OwnershipStrategy
+	combine    func(verdicts []Verdict) Verdict
+}
+
+func (s *compositeStrategy) Name() string {
+	var names []string
+	for _, strategy := range s.strategies {
+		names = append(names, strategy.Name())
+	}
+	return s.name + "(" + strings.Join(names, ", ") + ")"
+}
+
+func (s *compositeStrategy) Decide(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	inventory *StackInventory,
+) (*OwnershipDecision, error) {
+	var (
+		verdicts []Verdict
+		decision = &OwnershipDecision{}
+	)
+	for _, strategy := range s.strategies {
+		child, err := strategy.Decide(ctx, bucket, inventory)
+		if err != nil {
+			return nil, err
+		}
+		verdicts = append(verdicts, child.Verdict)
+		if decision.Stack == nil {
+			decision.Stack = child.Stack
+		}
+		decision.Evidence = append(
+			decision.Evidence,
+			strategy.Name()+": "+child.Verdict.String(),
+		)
+		for _, evidence := range child.Evidence {
+			decision.Evidence = append(decision.Evidence, "  "+evidence)
+		}
+	}
+	decision.Verdict = s.combine(verdicts)
+	return decision, nil
+}
+
+// anyOwns keeps a bucket any strategy considers owned.
+func anyOwns(verdicts []Verdict) Verdict {
+	result := VerdictUnknown
+	for _, verdict := range verdicts {
+		if verdict == VerdictOwned {
+			return VerdictOwned
+		}
+		if verdict == VerdictOrphaned {
+			result = VerdictOrphaned
+		}
+	}
+	return result
+}
+
+// allAgree only decides when every strategy reaches the same verdict.
+func allAgree(verdicts []Verdict) Verdict {
+	for _, verdict := range verdicts[1:] {
+		if verdict != verdicts[0] {
+			return VerdictUnknown
+		}
+	}
+	return verdicts[0]
+}
+
+// firstDecisive takes the first verdict that is not unknown.
+func firstDecisive(verdicts []Verdict) Verdict {
+	for _, verdict := range verdicts {
+		if verdict != VerdictUnknown {
+			return verdict
+		}
+	}
+	return VerdictUnknown
+}
+
+// Built-in ownership strategies and combinators for
+// ParseOwnershipStrategy.
+const (
+	OwnershipStrategyScore         = "score"
+	OwnershipStrategyNameAndDate   = "name-and-date"
+	OwnershipStrategyStackResource = "stack-resource"
+	OwnershipStrategyStackTag      = "stack-tag"
+
+	OwnershipAnyOwns       = "any-owns"
+	OwnershipAllAgree      = "all-agree"
+	OwnershipFirstDecisive = "first-decisive"
+)
+
+var ownershipStrategies = map[string]func() OwnershipStrategy{
+	OwnershipStrategyScore:         func() OwnershipStrategy { return &scoreStrategy{} },
+	OwnershipStrategyNameAndDate:   func() OwnershipStrategy { return &nameAndDateStrategy{} },
+	OwnershipStrategyStackResource: func() OwnershipStrategy { return &stackResourceStrategy{} },
+	OwnershipStrategyStackTag:      func() OwnershipStrategy { return &stackTagStrategy{} },
+}
+
+var ownershipCombinators = map[string]func([]Verdict) Verdict{
+	OwnershipAnyOwns:       anyOwns,
+	OwnershipAllAgree:      allAgree,
+	OwnershipFirstDecisive: firstDecisive,
+}
+
+func joinSorted(names []string) string {
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ParseOwnershipStrategy builds a strategy from a spec such as
+// "score" or "first-decisive(stack-resource, any-owns(stack-tag, score))".
+func ParseOwnershipStrategy(spec string) (OwnershipStrategy, error) {
+	strategy, rest, err := parseStrategySpec(spec)
+	if err == nil && strings.TrimSpace(rest) != "" {
+		err = fmt.Errorf("unexpected %q", strings.TrimSpace(rest))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid ownership strategy %q: %v", spec, err)
+	}
+	return strategy, nil
+}
+
+func parseStrategySpec(spec string) (OwnershipStrategy, string, error) {
+	spec = strings.TrimSpace(spec)
+	end := strings.IndexAny(spec, "(),")
+	if end < 0 {
+		end = len(spec)
+	}
+	name := strings.TrimSpace(spec[:end])
+	rest := spec[end:]
+	if !strings.HasPrefix(rest, "(") {
+		if build, ok := ownershipStrategies[name]; ok {
+			return build(), rest, nil
+		}
+		var names []string
+		for known := range ownershipStrategies {
+			names = append(names, known)
+		}
+		return nil, "", fmt.Errorf(
+			"unknown strategy %q, expected one of %s",
+			name,
+			joinSorted(names),
+		)
+	}
+	combine, ok := ownershipCombinators[name]
+	if !ok {
+		var names []string
+		for known := range ownershipCombinators {
+			names = append(names, known)
+		}
+		return nil, "", fmt.Errorf(
+			"unknown combinator %q, expected one of %s",
+			name,
+			joinSorted(names),
+		)
+	}
+	composite := &compositeStrategy{name: name, combine: combine}
+	rest = rest[1:]
+	for {
+		strategy, remaining, err := parseStrategySpec(rest)
+		if err != nil {
+			return nil, "", err
+		}
+		composite.strategies = append(composite.strategies, strategy)
+		remaining = strings.TrimSpace(remaining)
+		switch {
+		case strings.HasPrefix(remaining, ","):
+			rest = remaining[1:]
+		case strings.HasPrefix(remaining, ")"):
+			return composite, remaining[1:], nil
+		default:
+			return nil, "", fmt.Errorf("missing ) after %s", name)
+		}
+	}
+}
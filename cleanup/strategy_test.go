@@ -0,0 +1,208 @@
+package cleanup
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+// fixedStrategy always reaches the same verdict.
+type fixedStrategy struct {
+	verdict Verdict
+}
+
+func (s *fixedStrategy) Name() string {
+	return "fixed-" + s.verdict.String()
+}
+
+func (s *fixedStrategy) Decide(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	inventory *StackInventory,
+) (*OwnershipDecision, error) {
+	return &OwnershipDecision{Verdict: s.verdict, Evidence: []string{"fixed"}}, nil
+}
+
+func TestCompositeStrategies(t *testing.T) {
+	owned := &fixedStrategy{VerdictOwned}
+	orphaned := &fixedStrategy{VerdictOrphaned}
+	unknown := &fixedStrategy{VerdictUnknown}
+	var tests = []struct {
+		combine    func([]Verdict) Verdict
+		strategies []OwnershipStrategy
+		expected   Verdict
+	}{
+		{anyOwns, []OwnershipStrategy{orphaned, owned}, VerdictOwned},
+		{anyOwns, []OwnershipStrategy{unknown, orphaned}, VerdictOrphaned},
+		{anyOwns, []OwnershipStrategy{unknown, unknown}, VerdictUnknown},
+		{allAgree, []OwnershipStrategy{orphaned, orphaned}, VerdictOrphaned},
+		{allAgree, []OwnershipStrategy{orphaned, unknown}, VerdictUnknown},
+		{allAgree, []OwnershipStrategy{owned, orphaned}, VerdictUnknown},
+		{firstDecisive, []OwnershipStrategy{unknown, orphaned, owned}, VerdictOrphaned},
+		{firstDecisive, []OwnershipStrategy{unknown}, VerdictUnknown},
+	}
+	bucket := &s3.Bucket{Name: aws.String("bucket")}
+	for _, test := range tests {
+		strategy := &compositeStrategy{
+			name:       "test",
+			strategies: test.strategies,
+			combine:    test.combine,
+		}
+		decision, err := strategy.Decide(
+			context.Background(),
+			bucket,
+			(&Cleaner{}).stackInventory(),
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if decision.Verdict != test.expected {
+			t.Errorf(
+				"%v: expected verdict '%v' but got '%v'",
+				strategy.Name(),
+				test.expected,
+				decision.Verdict,
+			)
+		}
+		if len(decision.Evidence) != 2*len(test.strategies) {
+			t.Errorf("Expected evidence from every strategy but got %v", decision.Evidence)
+		}
+	}
+}
+
+func TestParseOwnershipStrategy(t *testing.T) {
+	var tests = []struct {
+		spec     string
+		expected string
+	}{
+		{spec: "score", expected: "score"},
+		{spec: " name-and-date ", expected: "name-and-date"},
+		{
+			spec:     "first-decisive(stack-resource, any-owns(stack-tag,score))",
+			expected: "first-decisive(stack-resource, any-owns(stack-tag, score))",
+		},
+	}
+	for _, test := range tests {
+		strategy, err := ParseOwnershipStrategy(test.spec)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.spec, err)
+			continue
+		}
+		if strategy.Name() != test.expected {
+			t.Errorf("Expected '%v' but got '%v'", test.expected, strategy.Name())
+		}
+	}
+	var errorTests = []struct {
+		spec     string
+		expected string
+	}{
+		{spec: "tags", expected: `unknown strategy "tags"`},
+		{spec: "most(score)", expected: `unknown combinator "most"`},
+		{spec: "any-owns(score", expected: "missing ) after any-owns"},
+		{spec: "any-owns(score))", expected: `unexpected ")"`},
+		{spec: "any-owns()", expected: `unknown strategy ""`},
+	}
+	for _, test := range errorTests {
+		_, err := ParseOwnershipStrategy(test.spec)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%v: expected error '%v' but got '%v'", test.spec, test.expected, err)
+		}
+	}
+}
+
+func TestStackStrategies(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	stacks := getOwnershipTestStacks()
+	csbc := &Cleaner{
+		s3SVC:  mockS3Iface,
+		stacks: stacks,
+		stackBuckets: map[string]*cloudformation.StackSummary{
+			"declared": stacks[0],
+		},
+	}
+	var tests = []struct {
+		strategy OwnershipStrategy
+		bucket   string
+		tag      string
+		expected Verdict
+	}{
+		{strategy: &stackResourceStrategy{}, bucket: "declared", expected: VerdictOwned},
+		{strategy: &stackResourceStrategy{}, bucket: "other", expected: VerdictUnknown},
+		{strategy: &stackTagStrategy{}, bucket: "live", tag: *stacks[0].StackId, expected: VerdictOwned},
+		{strategy: &stackTagStrategy{}, bucket: "dead", tag: "arn:deleted", expected: VerdictOrphaned},
+		{strategy: &stackTagStrategy{}, bucket: "untagged", expected: VerdictUnknown},
+	}
+	for _, test := range tests {
+		bucket := &s3.Bucket{Name: aws.String(test.bucket)}
+		if _, ok := test.strategy.(*stackTagStrategy); ok {
+			var tags []*s3.Tag
+			if test.tag != "" {
+				tags = append(
+					tags,
+					&s3.Tag{Key: aws.String(stackIDTag), Value: aws.String(test.tag)},
+				)
+			}
+			mockS3Iface.EXPECT().GetBucketTaggingWithContext(
+				gomock.Any(),
+				&s3.GetBucketTaggingInput{Bucket: bucket.Name},
+			).Return(&s3.GetBucketTaggingOutput{TagSet: tags}, nil)
+		}
+		inventory := csbc.stackInventory()
+		decision, err := test.strategy.Decide(context.Background(), bucket, inventory)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if decision.Verdict != test.expected {
+			t.Errorf(
+				"%v %v: expected verdict '%v' but got '%v'",
+				test.strategy.Name(),
+				test.bucket,
+				test.expected,
+				decision.Verdict,
+			)
+		}
+		// Tags are fetched once per run.
+		test.strategy.Decide(context.Background(), bucket, inventory)
+	}
+}
+
+func TestPlanKeepsUnknownOwnership(t *testing.T) {
+	_, mockS3Iface, ctrl := getMocks(t)
+	defer ctrl.Finish()
+	expectBucketConfiguration(mockS3Iface)
+
+	bucket := &s3.Bucket{
+		CreationDate: getTimeSecondsBeforeNow(300),
+		Name:         aws.String("oldstack-s3BucketTest"),
+	}
+	csbc := &Cleaner{
+		s3SVC:        mockS3Iface,
+		bucketFilter: "s3BucketTest",
+		strategy:     &stackResourceStrategy{},
+	}
+	mockS3Iface.EXPECT().ListBucketsWithContext(gomock.Any(), &s3.ListBucketsInput{}).Return(
+		&s3.ListBucketsOutput{Buckets: []*s3.Bucket{bucket}},
+		nil,
+	)
+	mockS3Iface.EXPECT().ListObjectsWithContext(
+		gomock.Any(),
+		&s3.ListObjectsInput{Bucket: bucket.Name},
+	).Return(&s3.ListObjectsOutput{}, nil)
+
+	errs := runRemoval(t, csbc)
+	if len(errs) > 0 {
+		t.Errorf("Expected 0 errors but got %v", len(errs))
+	}
+	if len(csbc.report) != 1 ||
+		csbc.report[0].Outcome != OutcomeSkipped ||
+		csbc.report[0].Reason != "unknown (stack-resource)" {
+		t.Errorf("Expected the bucket to be skipped but got %v", csbc.report)
+	}
+}
@@ -0,0 +1,106 @@
+package cleanup
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// templateUploadWindow is how long before a stack create, update or
+// change set the console or CLI may have uploaded its template.
+const templateUploadWindow = time.Hour
+
+func (c *Cleaner) getChangeSets(
+	ctx context.Context,
+	stackName *string,
+) ([]*cloudformation.ChangeSetSummary, error) {
+	var (
+		changeSets []*cloudformation.ChangeSetSummary
+		token      *string
+	)
+	for {
+		resp, err := c.cfSVC.ListChangeSetsWithContext(
+			ctx,
+			&cloudformation.ListChangeSetsInput{
+				NextToken: token,
+				StackName: stackName,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		changeSets = append(changeSets, resp.Summaries...)
+		if resp.NextToken == nil {
+			return changeSets, nil
+		}
+		token = resp.NextToken
+	}
+}
+
+// getStackActivity records when live stacks were created or last updated
+// and when their change sets were created. A template upload made shortly
+// before one of these moments may still be what the stack runs.
+func (c *Cleaner) getStackActivity(ctx context.Context) error {
+	c.stackActivity = []time.Time{}
+	stacks, err := c.describeStacks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, stack := range stacks {
+		for _, t := range []*time.Time{stack.CreationTime, stack.LastUpdatedTime} {
+			if t != nil {
+				c.stackActivity = append(c.stackActivity, *t)
+			}
+		}
+		changeSets, err := c.getChangeSets(ctx, stack.StackName)
+		if err != nil {
+			return err
+		}
+		for _, changeSet := range changeSets {
+			if changeSet.CreationTime != nil {
+				c.stackActivity = append(c.stackActivity, *changeSet.CreationTime)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Cleaner) matchesStackActivity(uploaded time.Time) bool {
+	for _, activity := range c.stackActivity {
+		diff := activity.Sub(uploaded)
+		if diff >= 0 && diff <= templateUploadWindow {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cleaner) isReferencedByStack(text string) bool {
+	for _, reference := range c.stackReferences {
+		if containsBucketName(reference.text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// staleTemplateUploads returns the old template uploads that no live stack
+// refers to, either by URL in its template, parameters or outputs, or by
+// having been created or updated right after the upload.
+func staleTemplateUploads(
+	c *Cleaner,
+	objects []*s3.Object,
+) []*s3.Object {
+	var stale []*s3.Object
+	for _, object := range objects {
+		if c.isPruneCandidate(object) &&
+			!c.isReferencedByStack(aws.StringValue(object.Key)) &&
+			!c.matchesStackActivity(*object.LastModified) {
+			stale = append(stale, object)
+		}
+	}
+	return stale
+}
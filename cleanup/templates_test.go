@@ -0,0 +1,92 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestGetStackActivity(t *testing.T) {
+	mockCloudformationiface, _, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	mockCloudformationiface.EXPECT().DescribeStacksWithContext(
+		gomock.Any(),
+		&cloudformation.DescribeStacksInput{},
+	).Return(
+		&cloudformation.DescribeStacksOutput{
+			Stacks: []*cloudformation.Stack{
+				&cloudformation.Stack{
+					StackName:       aws.String("app"),
+					CreationTime:    getTimeSecondsBeforeNow(100 * 86400),
+					LastUpdatedTime: getTimeSecondsBeforeNow(50 * 86400),
+				},
+			},
+		},
+		nil,
+	)
+	mockCloudformationiface.EXPECT().ListChangeSetsWithContext(
+		gomock.Any(),
+		&cloudformation.ListChangeSetsInput{StackName: aws.String("app")},
+	).Return(
+		&cloudformation.ListChangeSetsOutput{
+			Summaries: []*cloudformation.ChangeSetSummary{
+				&cloudformation.ChangeSetSummary{
+					CreationTime: getTimeSecondsBeforeNow(40 * 86400),
+				},
+			},
+		},
+		nil,
+	)
+
+	csbc := &Cleaner{cfSVC: mockCloudformationiface}
+	if err := csbc.getStackActivity(context.Background()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(csbc.stackActivity) != 3 {
+		t.Errorf("Expected 3 activity times but got %v", len(csbc.stackActivity))
+	}
+}
+
+func TestStaleTemplateUploads(t *testing.T) {
+	updated := getTimeSecondsBeforeNow(50 * 86400)
+	csbc := &Cleaner{
+		pruneMinAge:   30 * day,
+		stackActivity: []time.Time{*updated},
+		stackReferences: []*stackReference{
+			&stackReference{
+				stackName: "parent",
+				source:    "template",
+				text: `{"TemplateURL":"https://s3.amazonaws.com/` +
+					`cf-templates-1a2b3c4d5e6f-us-east-1/2019nested.yaml"}`,
+			},
+		},
+	}
+	objects := []*s3.Object{
+		&s3.Object{
+			Key:          aws.String("2019nested.yaml"),
+			LastModified: getTimeSecondsBeforeNow(200 * 86400),
+		},
+		&s3.Object{
+			Key:          aws.String("2020current.yaml"),
+			LastModified: aws.Time(updated.Add(-5 * time.Minute)),
+		},
+		&s3.Object{
+			Key:          aws.String("2018old.yaml"),
+			LastModified: getTimeSecondsBeforeNow(300 * 86400),
+		},
+		&s3.Object{
+			Key:          aws.String("2024recent.yaml"),
+			LastModified: getTimeSecondsBeforeNow(86400),
+		},
+	}
+	stale := staleTemplateUploads(csbc, objects)
+	if len(stale) != 1 || *stale[0].Key != "2018old.yaml" {
+		t.Errorf("Expected only the old unreferenced upload but got %v", stale)
+	}
+}
@@ -0,0 +1,107 @@
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// creationWindow bounds how long before and after a stack's creation its
+// bucket may have been created. Both bounds are exclusive.
+type creationWindow struct {
+	before time.Duration
+	after  time.Duration
+}
+
+// DefaultCreationWindow is how far apart bucket and stack creation may be
+// for the stack to own the bucket when Options.CreationWindow is zero.
+const DefaultCreationWindow = 60 * time.Second
+
+var defaultCreationWindow = &creationWindow{
+	before: DefaultCreationWindow,
+	after:  DefaultCreationWindow,
+}
+
+func newCreationWindow(width time.Duration, afterOnly bool) *creationWindow {
+	if afterOnly {
+		return &creationWindow{before: 0, after: width}
+	}
+	return &creationWindow{before: width, after: width}
+}
+
+func (w *creationWindow) matches(bucketDate time.Time, stackDate time.Time) bool {
+	diff := bucketDate.Sub(stackDate)
+	if w.before == 0 {
+		return diff >= 0 && diff < w.after
+	}
+	return diff > -w.before && diff < w.after
+}
+
+func (c *Cleaner) window() *creationWindow {
+	if c.creationWindow == nil {
+		return defaultCreationWindow
+	}
+	return c.creationWindow
+}
+
+// getBucketResources returns the logical ids of the stack's bucket
+// resources by physical id, listing the stack's resources once per stack.
+func (c *Cleaner) getBucketResources(
+	ctx context.Context,
+	stack *cloudformation.StackSummary,
+) (map[string]string, error) {
+	stackID := aws.StringValue(stack.StackId)
+	if names, ok := c.bucketResources[stackID]; ok {
+		return names, nil
+	}
+	resources, err := c.getStackResources(ctx, stack.StackId)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	for _, resource := range resources {
+		if aws.StringValue(resource.ResourceType) == s3BucketResourceType &&
+			resource.PhysicalResourceId != nil {
+			names[*resource.PhysicalResourceId] = aws.StringValue(resource.LogicalResourceId)
+		}
+	}
+	if c.bucketResources == nil {
+		c.bucketResources = map[string]map[string]string{}
+	}
+	c.bucketResources[stackID] = names
+	return names, nil
+}
+
+// matchCreationTime compares the bucket's creation with the stack's and
+// explains the comparison. When matchResourceTime is set the bucket
+// matches only if it is one of the stack's bucket resources, which holds
+// however long the deployment took or whenever the resource was updated.
+func (c *Cleaner) matchCreationTime(
+	ctx context.Context,
+	bucket *s3.Bucket,
+	stack *cloudformation.StackSummary,
+) (bool, string, error) {
+	bucketDate := aws.TimeValue(bucket.CreationDate)
+	if !c.matchResourceTime {
+		diff := bucketDate.Sub(aws.TimeValue(stack.CreationTime))
+		return c.window().matches(bucketDate, aws.TimeValue(stack.CreationTime)),
+			fmt.Sprintf("created %v from stack %s", diff, *stack.StackName),
+			nil
+	}
+	names, err := c.getBucketResources(ctx, stack)
+	if err != nil {
+		return false, "", err
+	}
+	if logicalID, ok := names[aws.StringValue(bucket.Name)]; ok {
+		return true, fmt.Sprintf(
+			"bucket resource %s of stack %s",
+			logicalID,
+			*stack.StackName,
+		), nil
+	}
+	return false, "not a bucket resource of stack " + *stack.StackName, nil
+}
@@ -0,0 +1,129 @@
+package cleanup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+)
+
+func TestCreationWindowMatches(t *testing.T) {
+	stackDate := *getTimeSecondsBeforeNow(1000)
+	var tests = []struct {
+		window   *creationWindow
+		offset   time.Duration
+		expected bool
+	}{
+		{window: newCreationWindow(10*time.Minute, false), offset: 5 * time.Minute, expected: true},
+		{window: newCreationWindow(10*time.Minute, false), offset: -5 * time.Minute, expected: true},
+		{window: newCreationWindow(10*time.Minute, false), offset: 11 * time.Minute, expected: false},
+		{window: newCreationWindow(10*time.Minute, true), offset: 5 * time.Minute, expected: true},
+		{window: newCreationWindow(10*time.Minute, true), offset: 0, expected: true},
+		{window: newCreationWindow(10*time.Minute, true), offset: -5 * time.Second, expected: false},
+	}
+	for _, test := range tests {
+		result := test.window.matches(stackDate.Add(test.offset), stackDate)
+		if result != test.expected {
+			t.Errorf(
+				"Expected '%v' for offset %v with %+v but got '%v'",
+				test.expected,
+				test.offset,
+				*test.window,
+				result,
+			)
+		}
+	}
+}
+
+func TestMatchCreationTimeByResource(t *testing.T) {
+	mockCloudformationiface, _, ctrl := getMocks(t)
+	defer ctrl.Finish()
+
+	stack := &cloudformation.StackSummary{
+		StackId:      aws.String("arn:teststack1"),
+		StackName:    aws.String("teststack1"),
+		CreationTime: getTimeSecondsBeforeNow(5000),
+	}
+	csbc := &Cleaner{
+		cfSVC:             mockCloudformationiface,
+		matchResourceTime: true,
+	}
+	gomock.InOrder(
+		mockCloudformationiface.EXPECT().ListStackResourcesWithContext(
+			gomock.Any(),
+			&cloudformation.ListStackResourcesInput{StackName: stack.StackId},
+		).Return(
+			&cloudformation.ListStackResourcesOutput{
+				StackResourceSummaries: []*cloudformation.StackResourceSummary{
+					&cloudformation.StackResourceSummary{
+						LogicalResourceId:  aws.String("Queue"),
+						PhysicalResourceId: aws.String("teststack1-queue"),
+						ResourceType:       aws.String("AWS::SQS::Queue"),
+					},
+				},
+				NextToken: aws.String("page2"),
+			},
+			nil,
+		),
+		mockCloudformationiface.EXPECT().ListStackResourcesWithContext(
+			gomock.Any(),
+			&cloudformation.ListStackResourcesInput{
+				StackName: stack.StackId,
+				NextToken: aws.String("page2"),
+			},
+		).Return(
+			&cloudformation.ListStackResourcesOutput{
+				StackResourceSummaries: []*cloudformation.StackResourceSummary{
+					&cloudformation.StackResourceSummary{
+						LogicalResourceId:    aws.String("Logs"),
+						PhysicalResourceId:   aws.String("teststack1-logs-1a2b"),
+						ResourceType:         aws.String(s3BucketResourceType),
+						LastUpdatedTimestamp: getTimeSecondsBeforeNow(10),
+					},
+				},
+			},
+			nil,
+		),
+	)
+
+	var tests = []struct {
+		bucket   *s3.Bucket
+		expected bool
+	}{
+		{
+			bucket: &s3.Bucket{
+				Name:         aws.String("teststack1-logs-1a2b"),
+				CreationDate: getTimeSecondsBeforeNow(2000),
+			},
+			expected: true,
+		},
+		{
+			bucket: &s3.Bucket{
+				Name:         aws.String("teststack1-queue"),
+				CreationDate: getTimeSecondsBeforeNow(5000),
+			},
+			expected: false,
+		},
+		{
+			bucket: &s3.Bucket{
+				Name:         aws.String("teststack1-other"),
+				CreationDate: getTimeSecondsBeforeNow(5000),
+			},
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		result, evidence, err := csbc.matchCreationTime(
+			context.Background(),
+			test.bucket,
+			stack,
+		)
+		if err != nil || result != test.expected {
+			t.Errorf("Expected '%v' but got '%v' (%v)", test.expected, result, evidence)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNotTerminal = errors.New(
+	"stdin is not a terminal; pass --yes to delete buckets without confirmation",
+)
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// checkConfirmation enforces that unattended runs opt in with --yes.
+func checkConfirmation(terminal bool, interactive bool, yes bool) error {
+	if yes || terminal {
+		return nil
+	}
+	if interactive {
+		return errors.New("--interactive needs a terminal on stdin")
+	}
+	return errNotTerminal
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestCheckConfirmation(t *testing.T) {
+	var tests = []struct {
+		terminal    bool
+		interactive bool
+		yes         bool
+		ok          bool
+	}{
+		{terminal: true, ok: true},
+		{terminal: true, interactive: true, ok: true},
+		{terminal: false, yes: true, ok: true},
+		{terminal: false, ok: false},
+		{terminal: false, interactive: true, ok: false},
+	}
+	for _, test := range tests {
+		err := checkConfirmation(test.terminal, test.interactive, test.yes)
+		if (err == nil) != test.ok {
+			t.Errorf("Expected ok '%v' for %+v but got %v", test.ok, test, err)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/PermissionData/cloudformation_s3bucket_cleanup
+
+go 1.20
+
+require (
+	github.com/allanliu/easylogger v0.0.0-00010101000000-000000000000
+	github.com/aws/aws-sdk-go v1.55.8
+	github.com/golang/mock v1.6.0
+	go.etcd.io/bbolt v1.3.8
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	golang.org/x/sys v0.4.0 // indirect
+)
+
+// The module proxy does not serve easylogger, see third_party/easylogger.
+replace github.com/allanliu/easylogger => ./third_party/easylogger
@@ -0,0 +1,293 @@
+// Package history keeps a local record of cleanup runs, so an incident
+// review can tell when a bucket first looked orphaned and who removed it.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/PermissionData/cloudformation_s3bucket_cleanup/cleanup"
+	"github.com/aws/aws-sdk-go/aws"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultPath is where the database is kept unless told otherwise.
+const DefaultPath = "cleanup-history.db"
+
+var (
+	runsBucket    = []byte("runs")
+	bucketsBucket = []byte("buckets")
+)
+
+// openTimeout is how long Open waits for another run holding the
+// database.
+const openTimeout = 5 * time.Second
+
+// Stack is a live stack as a run saw it.
+type Stack struct {
+	Name    string
+	Status  string
+	Created time.Time
+}
+
+// Candidate is a bucket a plan was going to act on, with the objects it
+// covered.
+type Candidate struct {
+	Bucket     string
+	Objects    int
+	Bytes      int64
+	Dependents []string
+}
+
+// Run records one plan and apply of a rule.
+type Run struct {
+	ID       uint64
+	Started  time.Time
+	Finished time.Time
+	// User is the ARN of the AWS identity the tool ran as and Host the
+	// machine it ran on.
+	User   string
+	Host   string
+	Rule   string
+	DryRun bool
+	// Err is why the run stopped early, if it did.
+	Err        string
+	Stacks     []*Stack
+	Candidates []*Candidate
+	Entries    []*cleanup.ReportEntry
+}
+
+// Event is what one run found or did to one bucket.
+type Event struct {
+	Run     uint64
+	Time    time.Time
+	User    string
+	Host    string
+	DryRun  bool
+	Rule    string
+	Outcome string
+	Reason  string
+}
+
+// DB is the history database, a bolt file.
+type DB struct {
+	db *bolt.DB
+}
+
+// Open opens the database at path, creating it if needed.
+func Open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return &DB{db: db}, nil
+}
+
+// Close releases the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// NewRun starts a run of the rule by the caller, the ARN of the AWS
+// identity the tool runs as, keeping the stacks the plan was decided
+// against, the buckets it planned to act on and every bucket it
+// considered. The plan is nil when planning failed.
+func NewRun(
+	rule string,
+	caller string,
+	started time.Time,
+	dryRun bool,
+	plan *cleanup.Plan,
+) *Run {
+	run := &Run{Rule: rule, User: caller, Started: started, DryRun: dryRun}
+	run.Host, _ = os.Hostname()
+	if plan == nil {
+		return run
+	}
+	for _, stack := range plan.Stacks {
+		run.Stacks = append(
+			run.Stacks,
+			&Stack{
+				Name:    aws.StringValue(stack.StackName),
+				Status:  aws.StringValue(stack.StackStatus),
+				Created: aws.TimeValue(stack.CreationTime),
+			},
+		)
+	}
+	for _, planned := range plan.Buckets {
+		run.Candidates = append(
+			run.Candidates,
+			&Candidate{
+				Bucket:     aws.StringValue(planned.Bucket.Name),
+				Objects:    len(planned.Objects),
+				Bytes:      planned.Size(),
+				Dependents: planned.Dependents,
+			},
+		)
+	}
+	run.Add(plan.Report)
+	return run
+}
+
+// Add appends report entries to the run.
+func (r *Run) Add(report []*cleanup.ReportEntry) {
+	r.Entries = append(r.Entries, report...)
+}
+
+func key(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+// Save stores a finished run and indexes its entries by bucket.
+func (d *DB) Save(run *Run) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		runs, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		buckets, err := tx.CreateBucketIfNotExists(bucketsBucket)
+		if err != nil {
+			return err
+		}
+		run.ID, err = runs.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		if err := runs.Put(key(run.ID), data); err != nil {
+			return err
+		}
+		for _, entry := range run.Entries {
+			events, err := buckets.CreateBucketIfNotExists([]byte(entry.Bucket))
+			if err != nil {
+				return err
+			}
+			id, err := events.NextSequence()
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(
+				&Event{
+					Run:     run.ID,
+					Time:    run.Finished,
+					User:    run.User,
+					Host:    run.Host,
+					DryRun:  run.DryRun,
+					Rule:    entry.Rule,
+					Outcome: entry.Outcome,
+					Reason:  entry.Reason,
+				},
+			)
+			if err != nil {
+				return err
+			}
+			if err := events.Put(key(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Runs returns every recorded run, oldest first.
+func (d *DB) Runs() ([]*Run, error) {
+	var runs []*Run
+	err := d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			run := &Run{}
+			if err := json.Unmarshal(v, run); err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			return nil
+		})
+	})
+	return runs, err
+}
+
+// BucketHistory returns what every run found or did to the bucket,
+// oldest first.
+func (d *DB) BucketHistory(name string) ([]*Event, error) {
+	var events []*Event
+	err := d.db.View(func(tx *bolt.Tx) error {
+		buckets := tx.Bucket(bucketsBucket)
+		if buckets == nil {
+			return nil
+		}
+		bucket := buckets.Bucket([]byte(name))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			event := &Event{}
+			if err := json.Unmarshal(v, event); err != nil {
+				return err
+			}
+			events = append(events, event)
+			return nil
+		})
+	})
+	return events, err
+}
+
+func who(name, host string) string {
+	if host == "" {
+		return name
+	}
+	return name + "@" + host
+}
+
+func (r *Run) String() string {
+	result := fmt.Sprintf(
+		"#%d %s %s",
+		r.ID,
+		r.Started.UTC().Format(time.RFC3339),
+		who(r.User, r.Host),
+	)
+	if r.Rule != "" {
+		result += " [" + r.Rule + "]"
+	}
+	if r.DryRun {
+		result += " dry run"
+	}
+	result += fmt.Sprintf(": %d stacks, %d buckets", len(r.Stacks), len(r.Entries))
+	if len(r.Candidates) > 0 {
+		result += fmt.Sprintf(", %d planned", len(r.Candidates))
+	}
+	if r.Err != "" {
+		result += ", failed: " + r.Err
+	}
+	return result
+}
+
+func (e *Event) String() string {
+	result := fmt.Sprintf(
+		"%s run #%d %s",
+		e.Time.UTC().Format(time.RFC3339),
+		e.Run,
+		who(e.User, e.Host),
+	)
+	if e.Rule != "" {
+		result += " [" + e.Rule + "]"
+	}
+	if e.DryRun {
+		result += " dry run"
+	}
+	result += ": " + e.Outcome
+	if e.Reason != "" {
+		result += " (" + e.Reason + ")"
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PermissionData/cloudformation_s3bucket_cleanup/cleanup"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func openTestDB(t *testing.T) (*DB, func()) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(filepath.Join(dir, DefaultPath))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSaveRuns(t *testing.T) {
+	db, closeDB := openTestDB(t)
+	defer closeDB()
+
+	if runs, err := db.Runs(); err != nil || len(runs) != 0 {
+		t.Fatalf("Expected no runs but got %v and %v", runs, err)
+	}
+	started := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	caller := "arn:aws:sts::123456789012:assumed-role/cleanup/nightly"
+	var tests = []struct {
+		dryRun  bool
+		plan    []*testEntry
+		applied []*testEntry
+	}{
+		{
+			dryRun:  true,
+			plan:    []*testEntry{{"team-a-web", cleanup.OutcomeKept, "owned by team-a"}},
+			applied: []*testEntry{{"oldstack-logs", cleanup.OutcomeWouldDelete, "3 objects, 10 bytes"}},
+		},
+		{
+			applied: []*testEntry{{"oldstack-logs", cleanup.OutcomeDeleted, ""}},
+		},
+	}
+	for i, test := range tests {
+		plan := &cleanup.Plan{
+			Buckets: []*cleanup.PlannedBucket{
+				&cleanup.PlannedBucket{
+					Bucket: &s3.Bucket{Name: aws.String("oldstack-logs")},
+					Objects: []*s3.Object{
+						&s3.Object{Key: aws.String("a"), Size: aws.Int64(4)},
+						&s3.Object{Key: aws.String("b"), Size: aws.Int64(6)},
+					},
+				},
+			},
+			Report: entries(test.plan),
+			Stacks: []*cloudformation.StackSummary{
+				&cloudformation.StackSummary{
+					StackName:    aws.String("team-a"),
+					StackStatus:  aws.String(cloudformation.StackStatusCreateComplete),
+					CreationTime: aws.Time(started.Add(-time.Hour)),
+				},
+			},
+		}
+		run := NewRun("nightly", caller, started.Add(time.Duration(i)*time.Hour), test.dryRun, plan)
+		run.Add(entries(test.applied))
+		run.Finished = run.Started.Add(time.Minute)
+		if err := db.Save(run); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if run.ID != uint64(i+1) {
+			t.Errorf("Expected run #%d but got #%d", i+1, run.ID)
+		}
+	}
+
+	runs, err := db.Runs()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(runs) != 2 || len(runs[0].Entries) != 2 ||
+		len(runs[0].Stacks) != 1 || runs[0].Stacks[0].Name != "team-a" ||
+		len(runs[0].Candidates) != 1 || runs[0].Candidates[0].Bytes != 10 ||
+		!strings.Contains(runs[0].String(), "#1 2026-10-01T12:00:00Z "+caller) ||
+		!strings.Contains(runs[0].String(), "[nightly] dry run: 1 stacks, 2 buckets, 1 planned") {
+		t.Errorf("Unexpected runs %v", runs)
+	}
+
+	events, err := db.BucketHistory("oldstack-logs")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(events) != 2 ||
+		events[0].Run != 1 || !events[0].DryRun ||
+		events[1].Run != 2 || events[1].Outcome != cleanup.OutcomeDeleted ||
+		events[1].User != caller ||
+		!strings.HasSuffix(events[0].String(), "[nightly] dry run: would be deleted (3 objects, 10 bytes)") {
+		t.Errorf("Unexpected history %v", events)
+	}
+	if events, err := db.BucketHistory("unknown"); err != nil || len(events) != 0 {
+		t.Errorf("Expected no history but got %v and %v", events, err)
+	}
+}
+
+func TestSaveFailedPlan(t *testing.T) {
+	db, done := openTestDB(t)
+	defer done()
+
+	run := NewRun("nightly", "", time.Now(), false, nil)
+	run.Err = "access denied"
+	if err := db.Save(run); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	runs, err := db.Runs()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(runs) != 1 || !strings.HasSuffix(runs[0].String(), "0 stacks, 0 buckets, failed: access denied") {
+		t.Errorf("Unexpected runs %v", runs)
+	}
+}
+
+type testEntry struct {
+	bucket  string
+	outcome string
+	reason  string
+}
+
+func entries(list []*testEntry) []*cleanup.ReportEntry {
+	var report []*cleanup.ReportEntry
+	for _, entry := range list {
+		report = append(
+			report,
+			&cleanup.ReportEntry{
+				Rule:    "nightly",
+				Bucket:  entry.bucket,
+				Outcome: entry.outcome,
+				Reason:  entry.reason,
+			},
+		)
+	}
+	return report
+}
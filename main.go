@@ -1,30 +1,650 @@
+//go:generate mockgen -destination=mock_s3iface/mock_s3iface.go -package=mock_s3iface github.com/aws/aws-sdk-go/service/s3/s3iface S3API
+//go:generate mockgen -destination=mock_cloudformationiface/mock_cloudformationiface.go -package=mock_cloudformationiface github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface CloudFormationAPI
+
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/PermissionData/cloudformation_s3bucket_cleanup/cleanup"
+	"github.com/PermissionData/cloudformation_s3bucket_cleanup/history"
 	"github.com/allanliu/easylogger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+var (
+	awsRegion = flag.String(
+		"aws-region",
+		"us-east-1",
+		"AWS region",
+	)
+	bucketFilter = flag.String(
+		"bucket-filter",
+		"exhibitors3bucket",
+		"Search critieria for buckets that fall under CF",
+	)
+	protectTag = flag.String(
+		"protect-tag",
+		"cleanup:protect=true",
+		"Tag (key=value) that protects a bucket from being deleted",
+	)
+	protectPolicySid = flag.String(
+		"protect-policy-sid",
+		"",
+		"Bucket policy statement Sid that protects a bucket from being deleted",
+	)
+	ignoreRetain = flag.Bool(
+		"ignore-retain",
+		false,
+		"Delete buckets left behind by DeletionPolicy: Retain on deleted stacks",
+	)
+	minBucketAgeDays = flag.Int(
+		"min-bucket-age-days",
+		0,
+		"Never delete a bucket created fewer than this many days ago",
+	)
+	minIdleDays = flag.Int(
+		"min-idle-days",
+		0,
+		"Never delete a bucket with an object modified fewer than this many days ago",
+	)
+	maxBuckets = flag.Int(
+		"max-buckets",
+		20,
+		"Abort if more than this many buckets would be deleted (0 for no limit)",
+	)
+	maxObjects = flag.Int64(
+		"max-objects",
+		0,
+		"Abort if more than this many objects would be deleted (0 for no limit)",
+	)
+	maxBytes = flag.Int64(
+		"max-bytes",
+		0,
+		"Abort if more than this many bytes would be deleted (0 for no limit)",
+	)
+	force = flag.Bool(
+		"force",
+		false,
+		"Proceed even when the run exceeds --max-buckets, --max-objects or --max-bytes",
+	)
+	interactive = flag.Bool(
+		"interactive",
+		false,
+		"Ask for approval before deleting each bucket",
+	)
+	yes = flag.Bool(
+		"yes",
+		false,
+		"Delete without confirmation; required when stdin is not a terminal",
+	)
+	skipReferenceCheck = flag.Bool(
+		"skip-reference-check",
+		false,
+		"Do not look for buckets referenced by live stack templates, parameters, outputs or exports",
+	)
+	deleteSharedBuckets = flag.Bool(
+		"delete-shared-buckets",
+		false,
+		"Allow deleting CDK bootstrap, SAM CLI managed and cf-templates buckets",
+	)
+	pruneShared = flag.Bool(
+		"prune-shared",
+		false,
+		"Prune stale objects inside shared buckets instead of deleting buckets",
+	)
+	pruneMinAgeDays = flag.Int(
+		"prune-min-age-days",
+		30,
+		"Only prune objects in shared buckets older than this many days",
+	)
+	dryRun = flag.Bool(
+		"dry-run",
+		false,
+		"Report what would be deleted or pruned without changing anything",
+	)
+	ownership = flag.String(
+		"ownership",
+		cleanup.OwnershipStrategyScore,
+		"Ownership strategy, e.g. score, name-and-date or first-decisive(stack-resource, score)",
+	)
+	ownershipThreshold = flag.Int(
+		"ownership-threshold",
+		cleanup.DefaultOwnershipThreshold,
+		"Ownership score at or above which a bucket is considered owned by a live stack",
+	)
+	creationWindowWidth = flag.Duration(
+		"creation-window",
+		cleanup.DefaultCreationWindow,
+		"How far apart bucket and stack creation may be for the stack to own the bucket",
+	)
+	creationWindowAfterOnly = flag.Bool(
+		"creation-window-after-only",
+		false,
+		"Only match buckets created after the stack, never before it",
+	)
+	matchResourceTime = flag.Bool(
+		"match-resource-time",
+		false,
+		"Match a bucket to a stack only when it is one of the stack's AWS::S3::Bucket resources, instead of comparing creation times",
+	)
+	policyExpression = flag.String(
+		"policy",
+		"",
+		"Expression a bucket must satisfy to be deleted, e.g. 'tags[\"env\"] != \"prod\" && idle_days > 30'",
+	)
+	action = flag.String(
+		"action",
+		cleanup.ActionDelete,
+		"What to do with orphaned buckets: report, tag, quarantine, lifecycle-expire, batch-manifest or delete",
+	)
+	batchManifestDir = flag.String(
+		"batch-manifest-dir",
+		cleanup.DefaultBatchManifestDir,
+		"Where batch-manifest writes the manifests and job definitions",
+	)
+	batchManifestBucket = flag.String(
+		"batch-manifest-bucket",
+		"",
+		"Bucket[/prefix] batch manifests are uploaded to and job reports written under",
+	)
+	batchAccountID = flag.String(
+		"batch-account-id",
+		"",
+		"Account that runs the batch-manifest jobs",
+	)
+	batchRoleArn = flag.String(
+		"batch-role-arn",
+		"",
+		"IAM role the batch-manifest jobs run as",
+	)
+	batchFunctionArn = flag.String(
+		"batch-function-arn",
+		"",
+		"Lambda function the batch-manifest jobs invoke to delete each object",
+	)
+	bypassGovernanceRetention = flag.Bool(
+		"bypass-governance-retention",
+		false,
+		"Delete objects under Object Lock governance retention instead of reporting their buckets as undeletable",
+	)
+	allowDependents = flag.Bool(
+		"allow-dependents",
+		false,
+		"Act on buckets with replication or event notifications depending on them instead of skipping them",
+	)
+	useInventory = flag.Bool(
+		"use-inventory",
+		false,
+		"Read bucket contents from the latest CSV S3 Inventory report instead of listing them",
+	)
+	lifecycleBackupBucket = flag.String(
+		"lifecycle-backup-bucket",
+		"",
+		"Bucket lifecycle-expire saves the lifecycle configurations it replaces to",
+	)
+	lifecycleBackupPrefix = flag.String(
+		"lifecycle-backup-prefix",
+		cleanup.DefaultLifecycleBackupPrefix,
+		"Key prefix of the lifecycle backups in --lifecycle-backup-bucket",
+	)
+	historyDB = flag.String(
+		"history-db",
+		history.DefaultPath,
+		"Local database recording every run; empty to keep no history",
+	)
+	configFile = flag.String(
+		"config",
+		"",
+		"YAML or JSON file of named cleanup rules, run one after another",
+	)
 )
 
 func init() {
-	flag.Parse()
 	easylogger.InitializeLog()
 }
 
+// parseTag splits a key=value flag into its parts. A tag without a value
+// matches any value for that key.
+func parseTag(tag string) (string, string) {
+	parts := strings.SplitN(tag, "=", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// newBatchJob builds the batch-manifest settings from the command line
+// flags, or returns nil when no manifest bucket is given.
+func newBatchJob() *cleanup.BatchJob {
+	if *batchManifestBucket == "" {
+		return nil
+	}
+	parts := strings.SplitN(*batchManifestBucket, "/", 2)
+	job := &cleanup.BatchJob{
+		Dir:         *batchManifestDir,
+		Bucket:      parts[0],
+		AccountID:   *batchAccountID,
+		RoleArn:     *batchRoleArn,
+		FunctionArn: *batchFunctionArn,
+	}
+	if len(parts) > 1 {
+		job.Prefix = parts[1]
+	}
+	return job
+}
+
+func getSessionConfigs(region string) (*session.Session, *aws.Config) {
+	return session.New(), &aws.Config{Region: aws.String(region)}
+}
+
+func newS3Client(region string) s3iface.S3API {
+	return s3.New(getSessionConfigs(region))
+}
+
+// callers caches the identity of the credentials the tool runs with per
+// region.
+var callers = map[string]*sts.GetCallerIdentityOutput{}
+
+// callerIdentity returns who the credentials the tool runs with in region
+// belong to, asking STS once.
+func callerIdentity(region string) (*sts.GetCallerIdentityOutput, error) {
+	if identity, ok := callers[region]; ok {
+		return identity, nil
+	}
+	identity, err := sts.New(getSessionConfigs(region)).GetCallerIdentity(
+		&sts.GetCallerIdentityInput{},
+	)
+	if err != nil {
+		return nil, err
+	}
+	callers[region] = identity
+	return identity, nil
+}
+
+// callerUserID returns the aws:userid of the credentials the tool runs
+// with, which the quarantine action exempts from its deny.
+func callerUserID(region string) string {
+	identity, err := callerIdentity(region)
+	easylogger.LogFatal(err)
+	return aws.StringValue(identity.UserId)
+}
+
+// callerARN returns the ARN the run history records the run under.
+func callerARN(region string) string {
+	identity, err := callerIdentity(region)
+	if err != nil {
+		easylogger.Log("Could not identify the caller for the run history: ", err)
+		return ""
+	}
+	return aws.StringValue(identity.Arn)
+}
+
+// withCaller fills in the caller's user id when the run quarantines.
+func withCaller(options cleanup.Options, region string) cleanup.Options {
+	if options.Action == cleanup.ActionQuarantine {
+		options.CallerUserID = callerUserID(region)
+	}
+	return options
+}
+
+// newOptions builds the options of a run in region from the command line
+// flags; a config rule may override parts of them afterwards.
+func newOptions(region string) cleanup.Options {
+	protectTagKey, protectTagValue := parseTag(*protectTag)
+	return cleanup.Options{
+		CloudFormation:            cloudformation.New(getSessionConfigs(region)),
+		S3:                        s3.New(getSessionConfigs(region)),
+		S3ForRegion:               newS3Client,
+		Region:                    region,
+		BucketFilter:              *bucketFilter,
+		ProtectTagKey:             protectTagKey,
+		ProtectTagValue:           protectTagValue,
+		ProtectPolicySid:          *protectPolicySid,
+		IgnoreRetain:              *ignoreRetain,
+		SkipReferenceCheck:        *skipReferenceCheck,
+		DeleteSharedBuckets:       *deleteSharedBuckets,
+		PruneShared:               *pruneShared,
+		PruneMinAge:               cleanup.DaysToDuration(*pruneMinAgeDays),
+		MinBucketAge:              cleanup.DaysToDuration(*minBucketAgeDays),
+		MinIdleAge:                cleanup.DaysToDuration(*minIdleDays),
+		MaxBuckets:                *maxBuckets,
+		MaxObjects:                *maxObjects,
+		MaxBytes:                  *maxBytes,
+		Force:                     *force,
+		DryRun:                    *dryRun,
+		Ownership:                 *ownership,
+		OwnershipThreshold:        *ownershipThreshold,
+		CreationWindow:            *creationWindowWidth,
+		CreationWindowAfterOnly:   *creationWindowAfterOnly,
+		MatchResourceTime:         *matchResourceTime,
+		Policy:                    *policyExpression,
+		Action:                    *action,
+		BatchJob:                  newBatchJob(),
+		LifecycleBackupBucket:     *lifecycleBackupBucket,
+		LifecycleBackupPrefix:     *lifecycleBackupPrefix,
+		UseInventory:              *useInventory,
+		BypassGovernanceRetention: *bypassGovernanceRetention,
+		AllowDependents:           *allowDependents,
+	}
+}
+
+func logReport(report []*cleanup.ReportEntry) {
+	for _, entry := range report {
+		easylogger.Log("Report: ", entry.String())
+	}
+}
+
+// plannedRun is one rule and region of the invocation, planned but not
+// applied yet.
+type plannedRun struct {
+	options cleanup.Options
+	cleaner *cleanup.Cleaner
+	plan    *cleanup.Plan
+	started time.Time
+}
+
+// planRun plans one run. The run is returned with the error so that the
+// failure can be recorded.
+func planRun(ctx context.Context, options cleanup.Options) (*plannedRun, error) {
+	run := &plannedRun{options: options, started: time.Now()}
+	cleaner, err := cleanup.New(options)
+	if err != nil {
+		return run, err
+	}
+	run.cleaner = cleaner
+	run.plan, err = cleaner.Plan(ctx)
+	if err != nil {
+		return run, err
+	}
+	logReport(run.plan.Report)
+	return run, nil
+}
+
+// abortRuns records every planned run as failed with err, none of them
+// applied, and exits.
+func abortRuns(db *history.DB, runs []*plannedRun, err error) {
+	for _, run := range runs {
+		run.save(db, nil, err)
+	}
+	if db != nil {
+		db.Close()
+	}
+	easylogger.LogFatal(err)
+}
+
+// checkLimits holds every planned run that removes data against the run
+// limits at once, before any of them is applied.
+func checkLimits(runs []*plannedRun) error {
+	var limited []*plannedRun
+	var plans []*cleanup.Plan
+	for _, run := range runs {
+		if run.plan.RemovesData() {
+			limited = append(limited, run)
+			plans = append(plans, run.plan)
+		}
+	}
+	if len(limited) == 0 {
+		return nil
+	}
+	return limited[0].cleaner.CheckLimits(plans)
+}
+
+// apply carries out the run's plan and records it, failed or not.
+func (r *plannedRun) apply(ctx context.Context, db *history.DB) ([]*s3.Error, error) {
+	result, err := r.cleaner.Apply(ctx, r.plan)
+	logReport(result.Report)
+	r.save(db, result, err)
+	return result.Errors, withForceHint(err)
+}
+
+// applyRuns applies the runs in order. Once one fails the rest are recorded
+// as not applied, so every run is in the history before the tool exits.
+func applyRuns(ctx context.Context, db *history.DB, runs []*plannedRun) ([]*s3.Error, error) {
+	var (
+		errs   []*s3.Error
+		runErr error
+	)
+	for _, run := range runs {
+		if runErr != nil {
+			run.save(db, nil, fmt.Errorf("not applied after an earlier run failed: %v", runErr))
+			continue
+		}
+		var runErrs []*s3.Error
+		runErrs, runErr = run.apply(ctx, db)
+		errs = append(errs, runErrs...)
+	}
+	return errs, runErr
+}
+
+func (r *plannedRun) save(db *history.DB, result *cleanup.Result, err error) {
+	saveRun(db, r.options, r.started, r.plan, result, err)
+}
+
+// withForceHint points at --force when the run limits refused a plan.
+func withForceHint(err error) error {
+	var limitErr *cleanup.LimitError
+	if errors.As(err, &limitErr) {
+		return fmt.Errorf("%v (use --force to override)", err)
+	}
+	return err
+}
+
+// commandArgs is the number of arguments each command takes. The empty
+// command is a normal run.
+var commandArgs = map[string]int{
+	"":             0,
+	"preflight":    0,
+	"runs":         0,
+	"explain":      1,
+	"rollback":     1,
+	"unquarantine": 1,
+	"history":      1,
+}
+
+// checkCommand rejects an unknown command or the wrong number of
+// arguments for it, so a typo never falls through to a deleting run.
+func checkCommand(args []string) error {
+	command := ""
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	count, ok := commandArgs[command]
+	if !ok {
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if len(args) < count {
+		return fmt.Errorf("%s needs a bucket name", command)
+	}
+	if len(args) > count {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(args[count:], " "))
+	}
+	return nil
+}
+
+// saveRun records a run in the history database, when one is kept. The
+// plan and result are nil when the run failed before them. A failure to
+// save is logged without failing the run.
+func saveRun(
+	db *history.DB,
+	options cleanup.Options,
+	started time.Time,
+	plan *cleanup.Plan,
+	result *cleanup.Result,
+	runErr error,
+) {
+	if db == nil {
+		return
+	}
+	record := history.NewRun(
+		options.RuleName,
+		callerARN(options.Region),
+		started,
+		options.DryRun,
+		plan,
+	)
+	if result != nil {
+		record.Add(result.Report)
+	}
+	record.Finished = time.Now()
+	if runErr != nil {
+		record.Err = runErr.Error()
+	}
+	if err := db.Save(record); err != nil {
+		easylogger.Log("Could not save the run history: ", err)
+	}
+}
+
+func openHistory() *history.DB {
+	if *historyDB == "" {
+		return nil
+	}
+	db, err := history.Open(*historyDB)
+	easylogger.LogFatal(err)
+	return db
+}
+
+// showHistory prints the recorded runs, or what they did to one bucket.
+func showHistory(command string, bucketName string) {
+	db := openHistory()
+	if db == nil {
+		easylogger.LogFatal(errors.New("no history database, see --history-db"))
+	}
+	defer db.Close()
+	if command == "runs" {
+		runs, err := db.Runs()
+		easylogger.LogFatal(err)
+		for _, run := range runs {
+			fmt.Fprintln(os.Stdout, run)
+		}
+		return
+	}
+	events, err := db.BucketHistory(bucketName)
+	easylogger.LogFatal(err)
+	if len(events) == 0 {
+		fmt.Fprintln(os.Stdout, "No runs have seen bucket", bucketName)
+	}
+	for _, event := range events {
+		fmt.Fprintln(os.Stdout, event)
+	}
+}
+
+// preflight plans a run and reports whether its action would fail on any
+// bucket. It returns false when one would.
+func preflight(ctx context.Context, options cleanup.Options) bool {
+	cleaner, err := cleanup.New(options)
+	easylogger.LogFatal(err)
+	plan, err := cleaner.Plan(ctx)
+	easylogger.LogFatal(err)
+	report, err := cleaner.Preflight(ctx, plan)
+	easylogger.LogFatal(err)
+	logReport(report)
+	for _, entry := range report {
+		if entry.Outcome == cleanup.OutcomeWouldFail {
+			return false
+		}
+	}
+	return true
+}
+
+// runOptions lists the runs to make: one from the flags, or one per
+// config rule and region.
+func runOptions(prompter *cleanup.Prompter) []cleanup.Options {
+	if *configFile == "" {
+		options := newOptions(*awsRegion)
+		options.Prompter = prompter
+		return []cleanup.Options{withCaller(options, *awsRegion)}
+	}
+	config, err := cleanup.LoadConfig(*configFile)
+	easylogger.LogFatal(err)
+	var runs []cleanup.Options
+	for _, rule := range config.Rules {
+		for _, region := range rule.RunRegions(*awsRegion) {
+			options := newOptions(region)
+			options.Prompter = prompter
+			rule.Apply(&options, region)
+			runs = append(runs, withCaller(options, region))
+		}
+	}
+	return runs
+}
+
 func main() {
-	svc := &cfS3BucketCleanup{
-		cfSVC:        cloudformation.New(getSessionConfigs()),
-		s3SVC:        s3.New(getSessionConfigs()),
-		bucketFilter: *bucketFilter,
-	}
-	svc.getAllCfStackNames()
-	errs := svc.removeUnusedCFBuckets()
-	if len(errs) > 0 {
-		for _, err := range errs {
-			easylogger.Log("Error: ", err.Message)
+	flag.Parse()
+	ctx := context.Background()
+	terminal := isTerminal(os.Stdin)
+	easylogger.LogFatal(checkCommand(flag.Args()))
+	command := flag.Arg(0)
+	if command == "runs" || command == "history" {
+		showHistory(command, flag.Arg(1))
+		return
+	}
+	if command != "explain" && command != "preflight" && !*dryRun {
+		easylogger.LogFatal(checkConfirmation(terminal, *interactive, *yes))
+	}
+	var prompter *cleanup.Prompter
+	if *interactive && terminal {
+		prompter = cleanup.NewPrompter(os.Stdin, os.Stdout)
+	}
+	if command == "explain" || command == "rollback" || command == "unquarantine" {
+		cleaner, err := cleanup.New(newOptions(*awsRegion))
+		easylogger.LogFatal(err)
+		switch command {
+		case "explain":
+			easylogger.LogFatal(cleaner.Explain(ctx, os.Stdout, flag.Arg(1)))
+		case "rollback":
+			easylogger.LogFatal(cleaner.RollbackLifecycle(ctx, flag.Arg(1)))
+		default:
+			easylogger.LogFatal(cleaner.Unquarantine(ctx, flag.Arg(1)))
+		}
+		return
+	}
+	if command == "preflight" {
+		ready := true
+		for _, options := range runOptions(nil) {
+			ready = preflight(ctx, options) && ready
+		}
+		if !ready {
+			os.Exit(1)
+		}
+		return
+	}
+	db := openHistory()
+	if db != nil {
+		defer db.Close()
+	}
+	var runs []*plannedRun
+	for _, options := range runOptions(prompter) {
+		run, err := planRun(ctx, options)
+		runs = append(runs, run)
+		if err != nil {
+			abortRuns(db, runs, err)
+		}
+	}
+	if err := checkLimits(runs); err != nil {
+		abortRuns(db, runs, withForceHint(err))
+	}
+	errs, err := applyRuns(ctx, db, runs)
+	for _, err := range errs {
+		easylogger.Log("Error: ", err.Message)
+	}
+	if err != nil {
+		easylogger.Log("Error: ", err)
+	}
+	if err != nil || len(errs) > 0 {
+		if db != nil {
+			db.Close()
 		}
 		os.Exit(1)
 	}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/PermissionData/cloudformation_s3bucket_cleanup/cleanup"
+)
+
+func TestParseTag(t *testing.T) {
+	var tests = []struct {
+		tag   string
+		key   string
+		value string
+	}{
+		{tag: "cleanup:protect=true", key: "cleanup:protect", value: "true"},
+		{tag: "cleanup:protect", key: "cleanup:protect", value: ""},
+		{tag: "owner=team=a", key: "owner", value: "team=a"},
+	}
+	for _, test := range tests {
+		key, value := parseTag(test.tag)
+		if key != test.key || value != test.value {
+			t.Errorf(
+				"Expected '%v' and '%v' but got '%v' and '%v'",
+				test.key,
+				test.value,
+				key,
+				value,
+			)
+		}
+	}
+}
+
+func TestWithForceHint(t *testing.T) {
+	limitErr := &cleanup.LimitError{What: "buckets", Count: 3, Limit: 2}
+	expected := "refusing to delete 3 buckets, the limit is 2 (use --force to override)"
+	if err := withForceHint(limitErr); err.Error() != expected {
+		t.Errorf("Expected '%v' but got '%v'", expected, err)
+	}
+	other := errors.New("access denied")
+	if err := withForceHint(other); err != other {
+		t.Errorf("Expected '%v' but got '%v'", other, err)
+	}
+	if err := withForceHint(nil); err != nil {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	var tests = []struct {
+		args []string
+		ok   bool
+	}{
+		{args: []string{}, ok: true},
+		{args: []string{"preflight"}, ok: true},
+		{args: []string{"runs"}, ok: true},
+		{args: []string{"explain", "team-a-logs"}, ok: true},
+		{args: []string{"unquarantine", "team-a-logs"}, ok: true},
+		{args: []string{"history", "team-a-logs"}, ok: true},
+		{args: []string{"explian", "team-a-logs"}, ok: false},
+		{args: []string{"team-a-logs"}, ok: false},
+		{args: []string{"rollback"}, ok: false},
+		{args: []string{"history"}, ok: false},
+		{args: []string{"preflight", "--dry-run"}, ok: false},
+		{args: []string{"explain", "team-a-logs", "team-b-logs"}, ok: false},
+	}
+	for _, test := range tests {
+		if err := checkCommand(test.args); (err == nil) != test.ok {
+			t.Errorf("Expected ok %v for %v but got %v", test.ok, test.args, err)
+		}
+	}
+}
+
+func TestCheckLimitsSkipsRunsKeepingData(t *testing.T) {
+	runs := []*plannedRun{
+		&plannedRun{plan: &cleanup.Plan{Action: cleanup.ActionReport}},
+		&plannedRun{plan: &cleanup.Plan{Action: cleanup.ActionTag}},
+	}
+	if err := checkLimits(runs); err != nil {
+		t.Errorf("Expected no limits for runs that keep the data but got %v", err)
+	}
+}
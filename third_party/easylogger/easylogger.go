@@ -0,0 +1,21 @@
+// Package easylogger stands in for github.com/allanliu/easylogger, which
+// the module proxy no longer serves. It provides the functions the tool
+// uses on top of the standard log package.
+package easylogger
+
+import "log"
+
+// InitializeLog sets up the logger. The standard logger needs no setup.
+func InitializeLog() {}
+
+// Log writes the values on one line.
+func Log(v ...interface{}) {
+	log.Println(v...)
+}
+
+// LogFatal logs err and exits when it is not nil.
+func LogFatal(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/allanliu/easylogger
+
+go 1.20